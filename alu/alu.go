@@ -46,6 +46,15 @@ func (alu *ALU) AddSignedToUnsigned(a, e byte) (result, hc, c byte) {
 	return
 }
 
+// Sign of the last e8, kept between cycles of an instruction. For save states.
+func (alu *ALU) GetAdj() byte {
+	return alu.adj
+}
+
+func (alu *ALU) SetAdj(adj byte) {
+	alu.adj = adj
+}
+
 // Adjust for signed integer addition
 func (alu *ALU) Adjust(a, c byte) (result byte) {
 	return a + c - alu.adj
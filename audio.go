@@ -0,0 +1,77 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mikzorz/goboy-emu/gameboy"
+)
+
+const audioSampleRate = 48000
+const audioBufferFrames = 1024              // frames per raylib sub-buffer
+const audioTargetFrames = audioBufferFrames // frames queued ahead of the device
+const audioMaxAdjust = 0.005                // resampler can stretch or squash by up to 0.5%
+
+// Streams APU samples to the audio device.
+// The queue fill level paces emulation, and nudges the resampler to avoid underruns.
+type AudioOutput struct {
+	stream    rl.AudioStream
+	resampler *Resampler
+	queue     []float32 // interleaved stereo frames waiting for the device
+	buf       []float32
+}
+
+func NewAudioOutput(gb *gameboy.Machine) *AudioOutput {
+	rl.SetAudioStreamBufferSizeDefault(audioBufferFrames)
+	a := &AudioOutput{
+		stream:    rl.LoadAudioStream(audioSampleRate, 32, 2),
+		resampler: NewResampler(audioSampleRate, audioSampleRate),
+		buf:       make([]float32, audioBufferFrames*2),
+	}
+	gb.SetSampleRate(audioSampleRate)
+	rl.PlayAudioStream(a.stream)
+	return a
+}
+
+func (a *AudioOutput) Close() {
+	rl.UnloadAudioStream(a.stream)
+}
+
+// Number of frames waiting to be sent to the device.
+func (a *AudioOutput) Queued() int {
+	return len(a.queue) / 2
+}
+
+// Resample new APU samples into the queue.
+// Output is stretched slightly when the queue is below target and squashed when above.
+func (a *AudioOutput) Push(samples []int16) {
+	fill := float64(a.Queued()-audioTargetFrames) / audioTargetFrames
+	fill = max(-1, min(1, fill))
+	a.resampler.SetAdjust(-fill * audioMaxAdjust)
+	a.queue = a.resampler.Process(samples, a.queue)
+
+	// Drop the backlog if the frontend stalled (e.g. window dragged), rather than lagging behind
+	if a.Queued() > audioTargetFrames*4 {
+		a.queue = a.queue[:copy(a.queue, a.queue[len(a.queue)-audioTargetFrames*2:])]
+	}
+}
+
+// Refill any sub-buffers the device has finished playing. Pads with silence on underrun.
+func (a *AudioOutput) Update() {
+	for rl.IsAudioStreamProcessed(a.stream) {
+		n := copy(a.buf, a.queue)
+		clear(a.buf[n:])
+		a.queue = a.queue[:copy(a.queue, a.queue[n:])]
+		// The binding takes the frame count from the slice length, the rest of the stereo frames follow in the backing array
+		rl.UpdateAudioStream(a.stream, a.buf[:audioBufferFrames])
+	}
+}
+
+// Queue the frame's samples and wait until the device has played enough of the queue.
+// Emulation is paced by the audio clock, so it runs at the DMG's ~59.73 Hz instead of the display's 60 Hz.
+func (a *AudioOutput) Sync(samples []int16) {
+	a.Push(samples)
+	a.Update()
+	for a.Queued() > audioTargetFrames {
+		rl.WaitTime(0.001)
+		a.Update()
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mikzorz/goboy-emu/gameboy"
+)
+
+// Settings come from, in increasing priority:
+//  1. the defaults in main.go and debug.go
+//  2. config.json in the user config dir, e.g. ~/.config/goboy-emu/config.json
+//  3. goboy.json next to the rom
+//  4. the command line
+// -config replaces 2 and 3 with a single file.
+
+const configDirName = "goboy-emu"
+const romConfigName = "goboy.json"
+
+// The config file format. Missing fields keep their current value.
+type config struct {
+	Dev           bool   `json:"dev"`
+	GameboyDoctor bool   `json:"gameboy_doctor"`
+	Scale         int32  `json:"scale"`
+	DebugFont     string `json:"debug_font"`
+	Palette       string `json:"palette"` // a name from palettes, or 4 hex colours from lightest, e.g. "ffffff,aaaaaa,555555,000000"
+	ScreenWidth   int32  `json:"screen_width"`
+
+	Bindings      map[string][]string `json:"bindings"`       // action: keys and buttons, see input.go
+	StickDeadzone float32             `json:"stick_deadzone"` // 0-1
+}
+
+var palettes = map[string][]color.RGBA{
+	"green": {
+		{155, 188, 15, 255},
+		{139, 172, 15, 255},
+		{48, 98, 48, 255},
+		{15, 56, 15, 255},
+	},
+	"grey": {
+		{255, 255, 255, 255},
+		{150, 150, 150, 255},
+		{60, 60, 60, 255},
+		{0, 0, 0, 255},
+	},
+}
+
+func parsePalette(s string) ([]color.RGBA, error) {
+	if p, ok := palettes[strings.ToLower(s)]; ok {
+		return p, nil
+	}
+
+	hexes := strings.Split(s, ",")
+	if len(hexes) != 4 {
+		return nil, fmt.Errorf("palette %q: want a name or 4 comma separated colours", s)
+	}
+	p := make([]color.RGBA, 4)
+	for i, h := range hexes {
+		h = strings.TrimPrefix(strings.TrimSpace(h), "#")
+		v, err := strconv.ParseUint(h, 16, 32)
+		if err != nil || len(h) != 6 {
+			return nil, fmt.Errorf("palette %q: bad colour %q", s, h)
+		}
+		p[i] = color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 255}
+	}
+	return p, nil
+}
+
+// Bind the settings to the command line. -config is only read by loadConfig.
+func defineSettingsFlags(flags *flag.FlagSet, configPath *string) {
+	flags.StringVar(configPath, "config", "", "Read settings from this JSON file instead of the default locations.")
+	flags.BoolVar(&DEV, "dev", DEV, "Show the debugger.")
+	flags.BoolVar(&GAMEBOY_DOCTOR, "gameboy-doctor", GAMEBOY_DOCTOR, "Write a Gameboy Doctor log to gbdoctor_logfile.log. Runs headless.")
+	flags.Func("scale", fmt.Sprintf("Window scale factor. (default %d)", gameWinScale), func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < 1 {
+			return fmt.Errorf("want a positive whole number")
+		}
+		gameWinScale = int32(n)
+		return nil
+	})
+	flags.StringVar(&debugFontPath, "debug-font", debugFontPath, "Font for the debugger.")
+	flags.Func("palette", "Screen colours, green, grey or 4 hex colours from lightest, e.g. ffffff,aaaaaa,555555,000000. (default green)", func(s string) error {
+		p, err := parsePalette(s)
+		if err == nil {
+			palette = p
+		}
+		return err
+	})
+	flags.Func("width", fmt.Sprintf("Screen width in pixels, more than %d shows what is drawn past the right edge. (default %d)", gameboy.SCREEN_WIDTH, gameboy.SCREEN_WIDTH), func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < gameboy.SCREEN_WIDTH || n > 256 {
+			return fmt.Errorf("want %d to 256", gameboy.SCREEN_WIDTH)
+		}
+		TRUEWIDTH = int32(n)
+		return nil
+	})
+}
+
+// Apply the config files for romPath, see the top of this file.
+func loadConfig(configPath, romPath string) error {
+	if configPath != "" {
+		return loadConfigFile(configPath, false)
+	}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		if err := loadConfigFile(filepath.Join(dir, configDirName, "config.json"), true); err != nil {
+			return err
+		}
+	}
+	return loadConfigFile(filepath.Join(filepath.Dir(romPath), romConfigName), true)
+}
+
+func loadConfigFile(path string, optional bool) error {
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c := config{
+		Dev:           DEV,
+		GameboyDoctor: GAMEBOY_DOCTOR,
+		Scale:         gameWinScale,
+		DebugFont:     debugFontPath,
+		ScreenWidth:   TRUEWIDTH,
+		StickDeadzone: stickDeadzone,
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if c.Scale < 1 {
+		return fmt.Errorf("%s: scale must be at least 1", path)
+	}
+	if c.ScreenWidth < gameboy.SCREEN_WIDTH || c.ScreenWidth > 256 {
+		return fmt.Errorf("%s: screen_width must be %d to 256", path, gameboy.SCREEN_WIDTH)
+	}
+	if c.StickDeadzone < 0 || c.StickDeadzone >= 1 {
+		return fmt.Errorf("%s: stick_deadzone must be 0 to less than 1", path)
+	}
+	if err := setBindings(c.Bindings); err != nil {
+		return fmt.Errorf("%s: bindings: %w", path, err)
+	}
+	if c.Palette != "" {
+		p, err := parsePalette(c.Palette)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		palette = p
+	}
+
+	DEV = c.Dev
+	GAMEBOY_DOCTOR = c.GameboyDoctor
+	gameWinScale = c.Scale
+	debugFontPath = c.DebugFont
+	TRUEWIDTH = c.ScreenWidth
+	stickDeadzone = c.StickDeadzone
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	p, err := parsePalette("#FFFFFF, aaaaaa,555555,000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (color.RGBA{0xAA, 0xAA, 0xAA, 255}); p[1] != want {
+		t.Errorf("want %v, got %v", want, p[1])
+	}
+	if p, _ := parsePalette("Grey"); p[0] != palettes["grey"][0] {
+		t.Errorf("named palettes should be case insensitive")
+	}
+	for _, bad := range []string{"", "purple", "ffffff,aaaaaa,555555", "ffffff,aaaaaa,555555,00000g"} {
+		if _, err := parsePalette(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	oldDev, oldScale, oldWidth, oldPalette := DEV, gameWinScale, TRUEWIDTH, palette
+	t.Cleanup(func() {
+		DEV, gameWinScale, TRUEWIDTH, palette = oldDev, oldScale, oldWidth, oldPalette
+	})
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir) // no user config
+	t.Setenv("HOME", dir)
+	romPath := filepath.Join(dir, "game.gb")
+	cfg := `{"dev": true, "scale": 5, "palette": "grey"}`
+	if err := os.WriteFile(filepath.Join(dir, romConfigName), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var configPath string
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	defineSettingsFlags(flags, &configPath)
+	args := []string{"-scale", "2", "-width", "256"}
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(configPath, romPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	if !DEV {
+		t.Errorf("dev should come from the file")
+	}
+	if palette[0] != palettes["grey"][0] {
+		t.Errorf("palette should come from the file")
+	}
+	if gameWinScale != 2 {
+		t.Errorf("command line should override the file, want scale 2, got %d", gameWinScale)
+	}
+	if TRUEWIDTH != 256 {
+		t.Errorf("want width 256, got %d", TRUEWIDTH)
+	}
+
+	if err := loadConfig(filepath.Join(dir, "missing.json"), romPath); err == nil {
+		t.Errorf("a missing -config file should be an error")
+	}
+}
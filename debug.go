@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mikzorz/goboy-emu/gameboy"
 	utils "github.com/mikzorz/goboy-emu/helpers"
 	"log"
 	"reflect"
@@ -13,86 +14,101 @@ import (
 var debugFontPath = "/usr/share/fonts/noto/NotoSansMono-Regular.ttf"
 var debugFont rl.Font
 
-var shouldDrawGame bool = true                                                                              // switch between displaying game screen or memory
 var memRowExample = "00000: " + strings.Repeat("00 ", bytesPerRow) + strings.Repeat(" ", (bytesPerRow/4)-1) // -1 because real string has extraneous space. could remove but...
 var memRowWidth = int32(((len(memRowExample) * fontSize) / 11) * 5)                                         // approximation
-var memSelection = 0
-var debugX int32 = max(memRowWidth, gameWindow.w) + 5
+
+// set by layoutWindows
+var debugX int32
 
 // Debug control
-var paused = true
-var cyclesPerFrame = 8
-var breakpoints = map[uint16]bool{}
-
-// int = how many occurrences to skip before pausing.
-// multiply by 4, because it decrements per tick, not per cycle
-var opOccurrences = map[byte]int{
-	// 0x40: 0, // LD B, B (used by mts tests, but also unintentionally matches CB 40)
-}
+type debugger struct {
+	paused         bool
+	cyclesPerFrame int
+	breakpoints    map[uint16]bool
 
-var opsWithArgs = map[byte]byte{}
+	// int = how many occurrences to skip before pausing.
+	// multiply by 4, because it decrements per tick, not per cycle
+	opOccurrences map[byte]int
+	opsWithArgs   map[byte]byte
 
-// Break after X amount of t-cycles
-var cyclebreaks = map[int]bool{}
-var curCycle = 0
+	// Break after X amount of t-cycles
+	cyclebreaks map[int]bool
+
+	memSelection   int
+	shouldDrawGame bool // switch between displaying game screen or memory
+}
+
+func newDebugger() *debugger {
+	return &debugger{
+		paused:         true,
+		cyclesPerFrame: 8,
+		breakpoints:    map[uint16]bool{},
+		opOccurrences:  map[byte]int{
+			// 0x40: 0, // LD B, B (used by mts tests, but also unintentionally matches CB 40)
+		},
+		opsWithArgs:    map[byte]byte{},
+		cyclebreaks:    map[int]bool{},
+		shouldDrawGame: true,
+	}
+}
 
 var disAssembleStart, disAssembleEnd uint16 = 0x0000, 0xFFFF
 
 const instructionsPeekAmount = 12 // How many lines above and below current instruction to show?
 
-func handleDebugInput() {
+// Keys handled by handleInput, bindings to them get a warning
+var debuggerKeys = []int32{
+	rl.KeyM, rl.KeyUp, rl.KeyDown, rl.KeyLeft, rl.KeyRight,
+	rl.KeyA, rl.KeyS, rl.KeyD, rl.KeySpace, rl.KeyLeftControl,
+}
+
+func (d *debugger) handleInput(gb *gameboy.Machine) {
 	if rl.IsKeyPressed(rl.KeyM) {
-		shouldDrawGame = !shouldDrawGame
+		d.shouldDrawGame = !d.shouldDrawGame
 	}
 
 	if rl.IsKeyPressed(rl.KeyDown) {
 		if rl.IsKeyDown(rl.KeyLeftShift) {
-			memSelection += 7
+			d.memSelection += 7
 		}
-		memSelection++ // Change debug mem selection
+		d.memSelection++ // Change debug mem selection
 	}
 	if rl.IsKeyPressed(rl.KeyUp) {
 		if rl.IsKeyDown(rl.KeyLeftShift) {
-			memSelection -= 7
+			d.memSelection -= 7
 		}
-		memSelection--
-		if memSelection < 0 {
-			memSelection = 0
+		d.memSelection--
+		if d.memSelection < 0 {
+			d.memSelection = 0
 		}
 	}
 
 	// 1 M-Cycle
 	if rl.IsKeyPressed(rl.KeyA) {
-		mcycle()
+		gb.MCycle()
 	}
 
 	// 1 Op (varying amount of cycles)
 	if rl.IsKeyPressed(rl.KeyS) {
-		prevOp := bus.cpu.IR
-		for prevOp == bus.cpu.IR {
-			mcycle()
-		}
+		gb.StepInstruction()
 	}
 
-	// 10 Ops (varying amount of cycles)
+	// 100 Ops (varying amount of cycles)
 	if rl.IsKeyPressed(rl.KeyD) {
 		for i := 0; i < 100; i++ {
-			prevOp := bus.cpu.IR
-			for prevOp == bus.cpu.IR {
-				mcycle()
-			}
+			gb.StepInstruction()
 		}
 	}
 
 	if rl.IsKeyPressed(rl.KeySpace) {
-		paused = !paused
+		d.paused = !d.paused
 	}
 
 	if rl.IsKeyPressed(rl.KeyRight) {
-		cyclesPerFrame *= 2
+		d.cyclesPerFrame *= 2
 	}
 	if rl.IsKeyPressed(rl.KeyLeft) {
-		cyclesPerFrame = max(cyclesPerFrame/2, 1)
+		d.cyclesPerFrame = max(d.cyclesPerFrame/2, 1)
 	}
 
 	if rl.IsKeyPressed(rl.KeyLeftControl) {
@@ -100,57 +116,74 @@ func handleDebugInput() {
 	}
 }
 
-func checkBreakpoints() bool {
-	if _, ok := breakpoints[bus.cpu.PC]; ok {
+// Run cyclesPerFrame T-cycles, stopping at any breakpoint.
+func (d *debugger) run(gb *gameboy.Machine) {
+	if d.paused {
+		return
+	}
+	for i := 0; i < d.cyclesPerFrame; i++ {
+		d.paused = d.checkBreakpoints(gb)
+
+		if d.paused {
+			return
+		}
+		gb.Tick()
+	}
+}
+
+func (d *debugger) checkBreakpoints(gb *gameboy.Machine) bool {
+	cpu := gb.Registers()
+	if _, ok := d.breakpoints[cpu.PC]; ok {
 		return true
-	} else if occ, ok := opOccurrences[bus.cpu.IR]; ok {
+	} else if occ, ok := d.opOccurrences[cpu.IR]; ok {
 		if occ > 0 {
-			opOccurrences[bus.cpu.IR]--
+			d.opOccurrences[cpu.IR]--
 		} else {
 			return true
 		}
-	} else if n8, ok := opsWithArgs[bus.cpu.IR]; ok {
-		if bus.Read(bus.cpu.PC) == n8 {
+	} else if n8, ok := d.opsWithArgs[cpu.IR]; ok {
+		if gb.Read(cpu.PC) == n8 {
 			return true
 		}
-	} else if _, ok := cyclebreaks[curCycle]; ok {
+	} else if _, ok := d.cyclebreaks[gb.Cycles()]; ok {
 		return true
 	}
 	return false
 }
 
 // Memory, registers, palettes, tiles etc.
-func drawDebugInfo() {
-	if !shouldDrawGame {
-		drawMem(memSelection*0x200, (memSelection+1)*0x200)
+func (d *debugger) draw(gb *gameboy.Machine) {
+	if !d.shouldDrawGame {
+		drawMem(gb, d.memSelection*0x200, (d.memSelection+1)*0x200)
 	}
-	// drawMem(0x8000, 0xC000)
+	// drawMem(gb, 0x8000, 0xC000)
 	// drawInstructions()
-	drawInstruction()
-	drawRegisters()
-	drawTimers()
-	tilePixels = getTileData()
-	drawTiles()
-	drawOAM()
+	drawInstruction(gb)
+	drawRegisters(gb)
+	drawTimers(gb)
+	tilePixels = getTileData(gb)
+	drawTiles(gb)
+	drawOAM(gb)
 
 	// Extra info (may or may not be actual registers)
 	// TODO: Tidy this up
-	drawRegister(curCycle, "tcycle", 0, 5)
-	drawRegister(bus.ppu.dot, "dot", 0, 6)
-	drawRegister(bus.ppu.x, "ppu x", 0, 7)
-	drawRegister(bus.lcd.GetX(), "lcd x", 0, 8)
-	drawRegister(bus.ppu.SCX, "SCX", 0, 9)
-	drawRegister(bus.ppu.SCY, "SCY", 0, 10)
-	drawRegister(bus.ppu.WX, "WX", 0, 11)
-	drawRegister(bus.ppu.WY, "WY", 0, 12)
-	drawRegister(string(bus.ppu.mode), "Mode", 0, 13)
-	drawRegister(bus.dma.oamDMA, "DMA", 0, 14)
-	drawRegister(utils.GetBit(7, bus.ppu.LCDC), "LCD On", 0, 15)
+	ppu := gb.PPU()
+	drawRegister(gb.Cycles(), "tcycle", 0, 5)
+	drawRegister(ppu.Dot, "dot", 0, 6)
+	drawRegister(ppu.X, "ppu x", 0, 7)
+	drawRegister(ppu.LCDX, "lcd x", 0, 8)
+	drawRegister(ppu.SCX, "SCX", 0, 9)
+	drawRegister(ppu.SCY, "SCY", 0, 10)
+	drawRegister(ppu.WX, "WX", 0, 11)
+	drawRegister(ppu.WY, "WY", 0, 12)
+	drawRegister(ppu.Mode, "Mode", 0, 13)
+	drawRegister(ppu.DMA, "DMA", 0, 14)
+	drawRegister(utils.GetBit(7, ppu.LCDC), "LCD On", 0, 15)
 
 	rl.DrawTextEx(debugFont, "<-, -> Change Speed, ^, v Scroll Ram, [Space] Pause/Unpause, [A] 1 M-Cycle, [S] 1 Op, [D] 100 Ops, [M] Toggle Mem/Screen, [LCtrl] Toggle Debugger", rl.Vector2{float32(5), float32(window.h - 5 - int32(fontSize))}, float32(fontSize), 0, rl.Blue)
 }
 
-func drawMem(start, end int) {
+func drawMem(gb *gameboy.Machine, start, end int) {
 	for row := 0; row <= (end-start)/bytesPerRow; row++ {
 		out := fmt.Sprintf("%05X: ", start+row*bytesPerRow)
 		for i := 0; i < bytesPerRow; i++ {
@@ -159,9 +192,9 @@ func drawMem(start, end int) {
 				return
 			}
 			if b >= 0x8000 && b <= 0x9FFF {
-				out += fmt.Sprintf("%02X ", bus.ppu.vram[uint16(b-0x8000)])
+				out += fmt.Sprintf("%02X ", gb.VRAM()[uint16(b-0x8000)])
 			} else {
-				out += fmt.Sprintf("%02X ", bus.Read(uint16(b)))
+				out += fmt.Sprintf("%02X ", gb.Read(uint16(b)))
 			}
 			if i%4 == 3 {
 				out += " "
@@ -218,8 +251,8 @@ func drawMem(start, end int) {
 // 	}
 // }
 
-func drawRegisters() {
-	cpu := bus.cpu
+func drawRegisters(gb *gameboy.Machine) {
+	cpu := gb.Registers()
 	drawRegister(cpu.IR, "IR", 0, 0)
 	drawRegister(cpu.WZ, "WZ", 0, 1)
 
@@ -240,9 +273,9 @@ func drawRegisters() {
 
 }
 
-func drawTimers() {
-	c := bus.clock
-	drawRegister(bus.Read(0xFF44), "LY", 1, 2)
+func drawTimers(gb *gameboy.Machine) {
+	c := gb.Timers()
+	drawRegister(gb.PPU().LY, "LY", 1, 2)
 	drawRegister(c.DIV, "DIV", 2, 2)
 	drawRegister(c.TIMA, "TIMA", 3, 2)
 	drawRegister(c.TMA, "TMA", 4, 2)
@@ -270,13 +303,13 @@ func drawRegister(r interface{}, name string, col, row int) {
 }
 
 // Find all current tiledata from IDs in VRAM and return as []byte.
-func getTileData() []byte {
+func getTileData(gb *gameboy.Machine) []byte {
 	// var tileAddrStart uint16 = 0x8000
 	var tileCount = 384   // DMG
 	var pixels = []byte{} // tiles * 8x8 pixels
 
 	for t := 0; t < tileCount; t++ {
-		tilePixels := getTileDataByID(t)
+		tilePixels := getTileDataByID(gb, t)
 		pixels = append(pixels, tilePixels...)
 	}
 
@@ -284,7 +317,8 @@ func getTileData() []byte {
 }
 
 // Return []byte containing 64 colour IDs, row by row.
-func getTileDataByID(tileID int) []byte {
+func getTileDataByID(gb *gameboy.Machine, tileID int) []byte {
+	vram := gb.VRAM()
 	pixels := make([]byte, 64)
 	// For each row of 8 pixels
 	//  Get the low and high bytes
@@ -292,8 +326,8 @@ func getTileDataByID(tileID int) []byte {
 	//  Save colour ID to a []byte
 	for tRow := 0; tRow < 8; tRow++ {
 		rAddr := uint16((tileID*8 + tRow) * 2)
-		loByte := bus.ppu.vram[rAddr]
-		hiByte := bus.ppu.vram[rAddr+1]
+		loByte := vram[rAddr]
+		hiByte := vram[rAddr+1]
 		for b := 7; b >= 0; b-- {
 			leftBit := utils.GetBit(b, hiByte)
 			rightBit := utils.GetBit(b, loByte)
@@ -306,7 +340,7 @@ func getTileDataByID(tileID int) []byte {
 }
 
 // Draw tile data image in debug area.
-func drawTiles() {
+func drawTiles(gb *gameboy.Machine) {
 	tilesPerRow := 16
 	tilesPerColumn := 8
 	pixPerRow := tilesPerRow * 8
@@ -319,17 +353,17 @@ func drawTiles() {
 			for tx := 0; tx < 16; tx++ {
 				txOffset := tx * pixPerTile
 				tileIdx := blockStart + tyOffset + txOffset
-				drawTile(tilePixels, tileIdx, debugX+int32(block*(pixPerRow+1)+tx*8), window.h-64-5-int32(fontSize)+int32(ty*8), 0xFF47)
+				drawTile(gb, tilePixels, tileIdx, debugX+int32(block*(pixPerRow+1)+tx*8), window.h-64-5-int32(fontSize)+int32(ty*8), 0xFF47)
 			}
 		}
 	}
 }
 
-func drawTile(pixels []byte, idx int, x, y int32, palAddr uint16) {
+func drawTile(gb *gameboy.Machine, pixels []byte, idx int, x, y int32, palAddr uint16) {
 	for row := 0; row < 8; row++ {
 		for column := 0; column < 8; column++ {
 			colourId := pixels[idx+row*8+column]
-			c := colours[(bus.Read(palAddr)>>(colourId*2))&0x3]
+			c := palette[(gb.Read(palAddr)>>(colourId*2))&0x3]
 
 			rl.DrawPixel(x+int32(column), y+int32(row), c)
 		}
@@ -337,36 +371,36 @@ func drawTile(pixels []byte, idx int, x, y int32, palAddr uint16) {
 }
 
 // Find all current OAM data from IDs in OAM and return as []byte.
-func getOAMTileIDs() []byte {
+func getOAMTileIDs(gb *gameboy.Machine) []byte {
 	var objectCount = 40
 	// var oamAddr = 0xFE00
 
 	// Every 4th tile, starting from FE02, is a tile index
 	tileIndices := []byte{}
 	for o := 0; o < objectCount; o++ {
-		tileIndices = append(tileIndices, bus.dma.oam[o*4+2])
+		tileIndices = append(tileIndices, gb.OAM()[o*4+2])
 	}
 
 	return tileIndices
 }
 
-func getOAMPixels() []byte {
+func getOAMPixels(gb *gameboy.Machine) []byte {
 	pixels := []byte{}
-	ids := getOAMTileIDs()
+	ids := getOAMTileIDs(gb)
 	for _, id := range ids {
-		tilePixels := getTileDataByID(int(id)) // TODO, account for bit.4 of byte 3 of oam data, DMG palette
+		tilePixels := getTileDataByID(gb, int(id)) // TODO, account for bit.4 of byte 3 of oam data, DMG palette
 		pixels = append(pixels, tilePixels...)
 	}
 	return pixels
 }
 
-func drawOAM() {
+func drawOAM(gb *gameboy.Machine) {
 	tilesPerRow := 5
 	tilesPerColumn := 8
 	// pixPerRow := tilesPerRow * 8
 	pixPerTile := 64
 
-	pixels := getOAMPixels()
+	pixels := getOAMPixels(gb)
 
 	for ty := 0; ty < tilesPerColumn; ty++ {
 		tyOffset := ty * tilesPerRow * pixPerTile
@@ -374,7 +408,7 @@ func drawOAM() {
 			txOffset := tx * pixPerTile
 			idx := tyOffset + txOffset
 			// 3*(16*8+1) puts OAM tiles after tile maps
-			drawTile(pixels, idx, debugX+int32(3*(16*8+1)+tx*8), window.h-64-5-int32(fontSize)+int32(ty*8), 0xFF47)
+			drawTile(gb, pixels, idx, debugX+int32(3*(16*8+1)+tx*8), window.h-64-5-int32(fontSize)+int32(ty*8), 0xFF47)
 		}
 	}
 }
@@ -510,73 +544,7 @@ func drawOAM() {
 // }
 
 // Draw the current instruction, with opcode and arguments, on the screen.
-func drawInstruction() {
-	inst := bus.cpu.inst
-	instOp := inst.Op
-	instAddr := bus.cpu.instAddr
-
-	t := inst.To
-	f := inst.From
-
-	// depending on instruction, figure out how many args to read, starting at current PC
-	s := fmt.Sprintf("%04X: %s", instAddr, instOp)
-
-	switch dt := bus.cpu.inst.DataType; dt {
-	case NODATA:
-		// Either no args, or args are registers / absolute values
-		if instOp == "RET" && inst.Flag != NOFLAG {
-			// RET
-			s += fmt.Sprintf(" %s", inst.Flag)
-		} else if instOp == "RST" {
-			s += fmt.Sprintf(" %02X", inst.Abs)
-		}
-
-		if inst.Prefixed {
-			s += fmt.Sprintf(" %d", inst.Bit)
-		}
-
-		if inst.To != "" {
-			s += fmt.Sprintf(" %s", t)
-		}
-		if inst.From != "" && !inst.Prefixed {
-			s += fmt.Sprintf(" %s", f)
-		}
-	case N8, A8:
-		// 1 arg
-		if t != "" && t != m8 {
-			s += fmt.Sprintf(" %s", t)
-		}
-		s += fmt.Sprintf(" %02X", bus.Read(instAddr+1))
-		if f != "" && f != m8 {
-			s += fmt.Sprintf(" %s", f)
-		}
-	case N16, A16:
-		// 2 args
-
-		if (instOp == "JP" || instOp == "CALL") && inst.Flag != NOFLAG {
-			s += fmt.Sprintf(" %s", inst.Flag)
-		}
-
-		if inst.To != "" {
-			s += fmt.Sprintf(" %s", t)
-		}
-
-		addr := utils.JoinBytes(bus.Read(instAddr+2), bus.Read(instAddr+1))
-		s += fmt.Sprintf(" %04X", addr)
-	case E8:
-		// 1 arg, with signed equivalent in parentheses (TODO)
-
-		if (instOp == "JR") && inst.Flag != NOFLAG {
-			s += fmt.Sprintf(" %s", inst.Flag)
-		}
-		n8 := bus.Read(instAddr + 1)
-		s += fmt.Sprintf(" %02X", n8)
-		e8 := int8(n8)
-		s += fmt.Sprintf(" (%d)", e8)
-	default:
-		log.Fatalf("unhandled datatype %s", dt)
-	}
-
-	rl.DrawTextEx(debugFont, fmt.Sprintf("PC: %04X", bus.cpu.PC), rl.Vector2{float32(debugX), float32(5)}, float32(fontSize), 0, rl.LightGray)
-	rl.DrawTextEx(debugFont, s, rl.Vector2{float32(debugX), float32(5 + fontSize)}, float32(fontSize), 0, rl.LightGray)
+func drawInstruction(gb *gameboy.Machine) {
+	rl.DrawTextEx(debugFont, fmt.Sprintf("PC: %04X", gb.Registers().PC), rl.Vector2{float32(debugX), float32(5)}, float32(fontSize), 0, rl.LightGray)
+	rl.DrawTextEx(debugFont, gb.CurrentInstruction(), rl.Vector2{float32(debugX), float32(5 + fontSize)}, float32(fontSize), 0, rl.LightGray)
 }
@@ -0,0 +1,359 @@
+package gameboy
+
+import (
+	"math"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Bits that always read back as 1, for NR10-NR52 (FF10-FF26).
+var apuReadMasks = [0x17]byte{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // FF15, NR21-NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // FF1F, NR41-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+}
+
+// Audio Processing Unit
+type APU struct {
+	bus     *Bus
+	enabled bool // NR52 bit 7
+	regs    [0x17]byte
+	ch1     SquareChannel
+	ch2     SquareChannel
+	ch3     WaveChannel
+	ch4     NoiseChannel
+
+	frameSeqStep int // next step of the 512 Hz frame sequencer, 0-7
+	prevDIVBit   bool
+
+	sampleRate    int // samples per second, 0 = no samples are produced
+	sampleCounter int
+	chargeFactor  float64 // high pass filter, removes the DAC DC offset
+	capLeft       float64
+	capRight      float64
+	samples       []int16 // interleaved left, right
+}
+
+// Powered off, as at power on.
+func newAPU() *APU {
+	a := &APU{}
+	a.ch1.HasSweep = true
+	a.ch1.Max = 64
+	a.ch2.Max = 64
+	a.ch3.Max = 256
+	a.ch4.Max = 64
+	return a
+}
+
+func NewAPU() *APU {
+	a := newAPU()
+	a.enabled = true
+
+	// Register values after the boot rom. Triggers are left out, the boot sound has already finished.
+	postBoot := []struct {
+		addr uint16
+		data byte
+	}{
+		{0xFF10, 0x80}, {0xFF11, 0xBF}, {0xFF12, 0xF3}, {0xFF13, 0xFF}, {0xFF14, 0x3F},
+		{0xFF16, 0x3F}, {0xFF17, 0x00}, {0xFF18, 0xFF}, {0xFF19, 0x3F},
+		{0xFF1A, 0x7F}, {0xFF1B, 0xFF}, {0xFF1C, 0x9F}, {0xFF1D, 0xFF}, {0xFF1E, 0x3F},
+		{0xFF20, 0xFF}, {0xFF21, 0x00}, {0xFF22, 0x00}, {0xFF23, 0x3F},
+		{0xFF24, 0x77}, {0xFF25, 0xF3},
+	}
+	for _, r := range postBoot {
+		a.Write(r.addr, r.data)
+	}
+	a.ch1.Enabled = true
+
+	return a
+}
+
+// Set the output sample rate. A rate of 0 stops sample generation.
+func (a *APU) SetSampleRate(rate int) {
+	if rate == a.sampleRate {
+		return
+	}
+	a.sampleRate = rate
+	a.sampleCounter = 0
+	a.samples = a.samples[:0]
+	if rate > 0 {
+		a.chargeFactor = math.Pow(0.999958, float64(CLOCK_SPEED)/float64(rate))
+	}
+}
+
+func (a *APU) SampleRate() int {
+	return a.sampleRate
+}
+
+// Returns the interleaved stereo samples produced since the last call.
+func (a *APU) Samples() []int16 {
+	s := a.samples
+	a.samples = make([]int16, 0, cap(s))
+	return s
+}
+
+// Called every T-cycle
+func (a *APU) Cycle() {
+	// Frame sequencer is clocked by the falling edge of DIV bit 12 (bit 4 of the readable DIV), 512 Hz
+	divBit := utils.IsBitSet(4, utils.MSB(a.bus.clock.DIV))
+	if a.prevDIVBit && !divBit && a.enabled {
+		a.clockFrameSequencer()
+	}
+	a.prevDIVBit = divBit
+
+	if a.enabled {
+		a.ch1.step()
+		a.ch2.step()
+		a.ch3.step()
+		a.ch4.step()
+	}
+
+	if a.sampleRate > 0 {
+		a.sampleCounter += a.sampleRate
+		if a.sampleCounter >= CLOCK_SPEED {
+			a.sampleCounter -= CLOCK_SPEED
+			l, r := a.mix()
+			a.samples = append(a.samples, l, r)
+		}
+	}
+}
+
+func (a *APU) clockFrameSequencer() {
+	switch a.frameSeqStep {
+	case 0, 4:
+		a.clockLength()
+	case 2, 6:
+		a.clockLength()
+		a.ch1.clockSweep()
+	case 7:
+		a.ch1.clockEnvelope()
+		a.ch2.clockEnvelope()
+		a.ch4.clockEnvelope()
+	}
+	a.frameSeqStep = (a.frameSeqStep + 1) & 0x7
+}
+
+func (a *APU) clockLength() {
+	if a.ch1.clockLength() {
+		a.ch1.Enabled = false
+	}
+	if a.ch2.clockLength() {
+		a.ch2.Enabled = false
+	}
+	if a.ch3.clockLength() {
+		a.ch3.Enabled = false
+	}
+	if a.ch4.clockLength() {
+		a.ch4.Enabled = false
+	}
+}
+
+// True if the last frame sequencer step clocked the length counters.
+func (a *APU) lengthClockedLast() bool {
+	return a.frameSeqStep%2 == 1
+}
+
+// Convert a channel's 4 bit output to analog, -1 to 1. A disabled DAC outputs 0.
+func dac(dacEnabled bool, digital byte) float64 {
+	if !dacEnabled {
+		return 0
+	}
+	return float64(digital)/7.5 - 1
+}
+
+func (a *APU) mix() (int16, int16) {
+	outs := [4]float64{
+		dac(a.ch1.DACEnabled, a.ch1.output()),
+		dac(a.ch2.DACEnabled, a.ch2.output()),
+		dac(a.ch3.DACEnabled, a.ch3.output()),
+		dac(a.ch4.DACEnabled, a.ch4.output()),
+	}
+
+	nr50 := a.regs[0xFF24-0xFF10]
+	nr51 := a.regs[0xFF25-0xFF10]
+	var left, right float64
+	for i, out := range outs {
+		if utils.IsBitSet(4+i, nr51) {
+			left += out
+		}
+		if utils.IsBitSet(i, nr51) {
+			right += out
+		}
+	}
+	left = left / 4 * float64((nr50>>4)&0x7+1) / 8
+	right = right / 4 * float64(nr50&0x7+1) / 8
+
+	left = a.highPass(left, &a.capLeft)
+	right = a.highPass(right, &a.capRight)
+	return toSample(left), toSample(right)
+}
+
+func (a *APU) highPass(in float64, capacitor *float64) float64 {
+	if !a.enabled {
+		return 0
+	}
+	out := in - *capacitor
+	*capacitor = in - out*a.chargeFactor
+	return out
+}
+
+func toSample(v float64) int16 {
+	v = math.Max(-1, math.Min(1, v))
+	return int16(v * math.MaxInt16)
+}
+
+func (a *APU) Read(addr uint16) byte {
+	switch {
+	case addr >= 0xFF30:
+		return a.ch3.readWaveRAM(addr)
+	case addr == 0xFF26:
+		status := byte(0x70)
+		if a.enabled {
+			status |= 0x80
+		}
+		for i, on := range []bool{a.ch1.Enabled, a.ch2.Enabled, a.ch3.Enabled, a.ch4.Enabled} {
+			if on {
+				status |= 1 << i
+			}
+		}
+		return status
+	case addr < 0xFF26:
+		return a.regs[addr-0xFF10] | apuReadMasks[addr-0xFF10]
+	default:
+		// FF27-FF2F, unused
+		return 0xFF
+	}
+}
+
+func (a *APU) Write(addr uint16, data byte) {
+	switch {
+	case addr >= 0xFF30:
+		a.ch3.writeWaveRAM(addr, data)
+		return
+	case addr == 0xFF26:
+		a.setPower(utils.IsBitSet(7, data))
+		return
+	case addr > 0xFF26:
+		return
+	}
+
+	if !a.enabled {
+		// While powered off, only the length counters can be written (DMG)
+		switch addr {
+		case 0xFF11:
+			a.ch1.writeLength(data & 0x3F)
+		case 0xFF16:
+			a.ch2.writeLength(data & 0x3F)
+		case 0xFF1B:
+			a.ch3.writeLength(data)
+		case 0xFF20:
+			a.ch4.writeLength(data & 0x3F)
+		}
+		return
+	}
+
+	a.regs[addr-0xFF10] = data
+
+	switch addr {
+	// Channel 1
+	case 0xFF10:
+		a.ch1.writeSweep(data)
+	case 0xFF11:
+		a.ch1.Duty = data >> 6
+		a.ch1.writeLength(data & 0x3F)
+	case 0xFF12:
+		a.ch1.writeNRx2(data)
+	case 0xFF13:
+		a.ch1.Freq = a.ch1.Freq&0x700 | uint16(data)
+	case 0xFF14:
+		a.ch1.Freq = a.ch1.Freq&0xFF | uint16(data&0x7)<<8
+		if a.ch1.writeNRx4(data, a.lengthClockedLast()) {
+			a.ch1.Enabled = false
+		}
+		if utils.IsBitSet(7, data) {
+			a.ch1.trigger()
+		}
+
+	// Channel 2
+	case 0xFF16:
+		a.ch2.Duty = data >> 6
+		a.ch2.writeLength(data & 0x3F)
+	case 0xFF17:
+		a.ch2.writeNRx2(data)
+	case 0xFF18:
+		a.ch2.Freq = a.ch2.Freq&0x700 | uint16(data)
+	case 0xFF19:
+		a.ch2.Freq = a.ch2.Freq&0xFF | uint16(data&0x7)<<8
+		if a.ch2.writeNRx4(data, a.lengthClockedLast()) {
+			a.ch2.Enabled = false
+		}
+		if utils.IsBitSet(7, data) {
+			a.ch2.trigger()
+		}
+
+	// Channel 3
+	case 0xFF1A:
+		a.ch3.DACEnabled = utils.IsBitSet(7, data)
+		if !a.ch3.DACEnabled {
+			a.ch3.Enabled = false
+		}
+	case 0xFF1B:
+		a.ch3.writeLength(data)
+	case 0xFF1C:
+		a.ch3.VolumeCode = (data >> 5) & 0x3
+	case 0xFF1D:
+		a.ch3.Freq = a.ch3.Freq&0x700 | uint16(data)
+	case 0xFF1E:
+		a.ch3.Freq = a.ch3.Freq&0xFF | uint16(data&0x7)<<8
+		if a.ch3.writeNRx4(data, a.lengthClockedLast()) {
+			a.ch3.Enabled = false
+		}
+		if utils.IsBitSet(7, data) {
+			a.ch3.trigger()
+		}
+
+	// Channel 4
+	case 0xFF20:
+		a.ch4.writeLength(data & 0x3F)
+	case 0xFF21:
+		a.ch4.writeNRx2(data)
+	case 0xFF22:
+		a.ch4.writePolynomial(data)
+	case 0xFF23:
+		if a.ch4.writeNRx4(data, a.lengthClockedLast()) {
+			a.ch4.Enabled = false
+		}
+		if utils.IsBitSet(7, data) {
+			a.ch4.trigger()
+		}
+	}
+}
+
+// NR52 bit 7. Powering off clears every register except the length counters and wave RAM.
+func (a *APU) setPower(on bool) {
+	if on == a.enabled {
+		return
+	}
+
+	if !on {
+		lengths := [4]int{a.ch1.Length, a.ch2.Length, a.ch3.Length, a.ch4.Length}
+		for addr := uint16(0xFF10); addr <= 0xFF25; addr++ {
+			a.Write(addr, 0)
+		}
+		a.ch1.Length, a.ch2.Length, a.ch3.Length, a.ch4.Length = lengths[0], lengths[1], lengths[2], lengths[3]
+		a.ch1.Enabled = false
+		a.ch2.Enabled = false
+		a.ch3.Enabled = false
+		a.ch4.Enabled = false
+		a.enabled = false
+		return
+	}
+
+	a.enabled = true
+	a.frameSeqStep = 0
+	a.ch1.DutyPos = 0
+	a.ch2.DutyPos = 0
+	a.ch3.SampleBuffer = 0
+}
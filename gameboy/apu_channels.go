@@ -0,0 +1,331 @@
+package gameboy
+
+import (
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Channel fields are exported so the channels can be copied into save states as they are.
+
+// Length counter, shared by all channels. Turns the channel off when it reaches 0.
+type LengthCounter struct {
+	Length  int
+	Enabled bool
+	Max     int // 64, or 256 for the wave channel
+}
+
+// Clocked at 256 Hz by the frame sequencer. Returns true if the counter just expired.
+func (l *LengthCounter) clockLength() bool {
+	if l.Enabled && l.Length > 0 {
+		l.Length--
+		return l.Length == 0
+	}
+	return false
+}
+
+func (l *LengthCounter) writeLength(data byte) {
+	l.Length = l.Max - int(data)
+}
+
+// Handle the length enable and trigger bits of NRx4.
+// If the frame sequencer's last step clocked length, enabling length clocks it once more,
+// and a trigger that reloads an empty counter reloads it one lower. Returns true if the channel should be disabled.
+func (l *LengthCounter) writeNRx4(data byte, lengthClockedLast bool) (disable bool) {
+	wasEnabled := l.Enabled
+	l.Enabled = utils.IsBitSet(6, data)
+	trigger := utils.IsBitSet(7, data)
+
+	if lengthClockedLast && !wasEnabled && l.Enabled && l.Length > 0 {
+		l.Length--
+		if l.Length == 0 && !trigger {
+			disable = true
+		}
+	}
+
+	if trigger && l.Length == 0 {
+		l.Length = l.Max
+		if l.Enabled && lengthClockedLast {
+			l.Length--
+		}
+	}
+	return
+}
+
+// Volume envelope, used by the square and noise channels.
+type Envelope struct {
+	InitialVolume byte
+	Up            bool
+	Period        byte
+	Volume        byte
+	EnvTimer      byte
+}
+
+func (e *Envelope) writeEnvelope(data byte) {
+	e.InitialVolume = data >> 4
+	e.Up = utils.IsBitSet(3, data)
+	e.Period = data & 0x7
+}
+
+func (e *Envelope) triggerEnvelope() {
+	e.Volume = e.InitialVolume
+	e.EnvTimer = e.Period
+	if e.EnvTimer == 0 {
+		e.EnvTimer = 8
+	}
+}
+
+// Clocked at 64 Hz by the frame sequencer.
+func (e *Envelope) clockEnvelope() {
+	if e.Period == 0 {
+		return
+	}
+	if e.EnvTimer > 0 {
+		e.EnvTimer--
+	}
+	if e.EnvTimer == 0 {
+		e.EnvTimer = e.Period
+		if e.Up && e.Volume < 15 {
+			e.Volume++
+		} else if !e.Up && e.Volume > 0 {
+			e.Volume--
+		}
+	}
+}
+
+// 12.5%, 25%, 50% and 75% duty cycles
+var dutyTable = [4][8]byte{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+// Channels 1 and 2. Channel 1 also has a frequency sweep.
+type SquareChannel struct {
+	Enabled    bool
+	DACEnabled bool
+	Duty       byte
+	DutyPos    byte
+	Freq       uint16 // 11 bits
+	Timer      int
+	LengthCounter
+	Envelope
+
+	HasSweep        bool
+	SweepPeriod     byte
+	SweepNegate     bool
+	SweepShift      byte
+	SweepTimer      byte
+	SweepEnabled    bool
+	ShadowFreq      uint16
+	SweepNegateUsed bool // a calculation in negate mode has happened since the last trigger
+}
+
+func (c *SquareChannel) step() {
+	c.Timer--
+	if c.Timer <= 0 {
+		c.Timer = (2048 - int(c.Freq)) * 4
+		c.DutyPos = (c.DutyPos + 1) & 0x7
+	}
+}
+
+func (c *SquareChannel) output() byte {
+	if c.Enabled && dutyTable[c.Duty][c.DutyPos] == 1 {
+		return c.Volume
+	}
+	return 0
+}
+
+// NRx2, the DAC is off if the upper 5 bits are 0, which also turns the channel off.
+func (c *SquareChannel) writeNRx2(data byte) {
+	c.writeEnvelope(data)
+	c.DACEnabled = data&0xF8 != 0
+	if !c.DACEnabled {
+		c.Enabled = false
+	}
+}
+
+func (c *SquareChannel) trigger() {
+	c.Enabled = c.DACEnabled
+	c.Timer = (2048 - int(c.Freq)) * 4
+	c.triggerEnvelope()
+
+	if c.HasSweep {
+		c.ShadowFreq = c.Freq
+		c.SweepTimer = c.SweepPeriod
+		if c.SweepTimer == 0 {
+			c.SweepTimer = 8
+		}
+		c.SweepEnabled = c.SweepPeriod != 0 || c.SweepShift != 0
+		c.SweepNegateUsed = false
+		if c.SweepShift != 0 {
+			c.sweepCalc()
+		}
+	}
+}
+
+// NR10
+func (c *SquareChannel) writeSweep(data byte) {
+	c.SweepPeriod = (data >> 4) & 0x7
+	negate := utils.IsBitSet(3, data)
+	// Leaving negate mode after a negate calculation turns the channel off
+	if c.SweepNegateUsed && !negate {
+		c.Enabled = false
+	}
+	c.SweepNegate = negate
+	c.SweepShift = data & 0x7
+}
+
+// Calculate the next sweep frequency, turning the channel off if it overflows.
+func (c *SquareChannel) sweepCalc() uint16 {
+	delta := c.ShadowFreq >> c.SweepShift
+	freq := c.ShadowFreq + delta
+	if c.SweepNegate {
+		freq = c.ShadowFreq - delta
+		c.SweepNegateUsed = true
+	}
+	if freq > 2047 {
+		c.Enabled = false
+	}
+	return freq
+}
+
+// Clocked at 128 Hz by the frame sequencer.
+func (c *SquareChannel) clockSweep() {
+	if c.SweepTimer > 0 {
+		c.SweepTimer--
+	}
+	if c.SweepTimer != 0 {
+		return
+	}
+
+	c.SweepTimer = c.SweepPeriod
+	if c.SweepTimer == 0 {
+		c.SweepTimer = 8
+	}
+
+	if c.SweepEnabled && c.SweepPeriod != 0 {
+		freq := c.sweepCalc()
+		if freq <= 2047 && c.SweepShift != 0 {
+			c.ShadowFreq = freq
+			c.Freq = freq
+			// Overflow check with the new frequency, result is discarded
+			c.sweepCalc()
+		}
+	}
+}
+
+// Channel 3, plays 32 4-bit samples from wave RAM.
+type WaveChannel struct {
+	Enabled      bool
+	DACEnabled   bool
+	Freq         uint16
+	Timer        int
+	Pos          byte // 0-31, sample index in wave RAM
+	SampleBuffer byte
+	VolumeCode   byte // 0 = mute, 1 = 100%, 2 = 50%, 3 = 25%
+	WaveRAM      [16]byte
+	LengthCounter
+}
+
+func (c *WaveChannel) step() {
+	c.Timer--
+	if c.Timer <= 0 {
+		c.Timer = (2048 - int(c.Freq)) * 2
+		c.Pos = (c.Pos + 1) & 0x1F
+		c.SampleBuffer = c.WaveRAM[c.Pos/2]
+		if c.Pos%2 == 0 {
+			c.SampleBuffer >>= 4
+		}
+		c.SampleBuffer &= 0xF
+	}
+}
+
+func (c *WaveChannel) output() byte {
+	if !c.Enabled || c.VolumeCode == 0 {
+		return 0
+	}
+	return c.SampleBuffer >> (c.VolumeCode - 1)
+}
+
+func (c *WaveChannel) trigger() {
+	c.Enabled = c.DACEnabled
+	// Extra delay before the first sample is read
+	c.Timer = (2048-int(c.Freq))*2 + 6
+	c.Pos = 0
+}
+
+// While the channel is playing, wave RAM accesses go to the byte currently being played.
+func (c *WaveChannel) readWaveRAM(addr uint16) byte {
+	if c.Enabled {
+		return c.WaveRAM[c.Pos/2]
+	}
+	return c.WaveRAM[addr-0xFF30]
+}
+
+func (c *WaveChannel) writeWaveRAM(addr uint16, data byte) {
+	if c.Enabled {
+		c.WaveRAM[c.Pos/2] = data
+	} else {
+		c.WaveRAM[addr-0xFF30] = data
+	}
+}
+
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+// Channel 4, pseudo random noise from a linear feedback shift register.
+type NoiseChannel struct {
+	Enabled     bool
+	DACEnabled  bool
+	ClockShift  byte
+	WidthMode   bool // 7 bit LFSR instead of 15 bit
+	DivisorCode byte
+	Timer       int
+	LFSR        uint16
+	LengthCounter
+	Envelope
+}
+
+func (c *NoiseChannel) period() int {
+	return noiseDivisors[c.DivisorCode] << c.ClockShift
+}
+
+func (c *NoiseChannel) step() {
+	c.Timer--
+	if c.Timer <= 0 {
+		c.Timer = c.period()
+		xor := (c.LFSR & 0x1) ^ ((c.LFSR >> 1) & 0x1)
+		c.LFSR = (c.LFSR >> 1) | (xor << 14)
+		if c.WidthMode {
+			c.LFSR = (c.LFSR &^ (1 << 6)) | (xor << 6)
+		}
+	}
+}
+
+func (c *NoiseChannel) output() byte {
+	if c.Enabled && c.LFSR&0x1 == 0 {
+		return c.Volume
+	}
+	return 0
+}
+
+func (c *NoiseChannel) writeNRx2(data byte) {
+	c.writeEnvelope(data)
+	c.DACEnabled = data&0xF8 != 0
+	if !c.DACEnabled {
+		c.Enabled = false
+	}
+}
+
+// NR43
+func (c *NoiseChannel) writePolynomial(data byte) {
+	c.ClockShift = data >> 4
+	c.WidthMode = utils.IsBitSet(3, data)
+	c.DivisorCode = data & 0x7
+}
+
+func (c *NoiseChannel) trigger() {
+	c.Enabled = c.DACEnabled
+	c.Timer = c.period()
+	c.LFSR = 0x7FFF
+	c.triggerEnvelope()
+}
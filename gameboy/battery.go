@@ -0,0 +1,97 @@
+package gameboy
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Implemented by carts that can keep RAM alive with a battery.
+// Only carts whose header type includes a battery are actually saved.
+type BatteryCart interface {
+	Cartridge
+	// Contents of the .sav file, raw RAM followed by any mapper specific footer. Marks RAM as saved.
+	SaveData() []byte
+	LoadSaveData([]byte)
+	// RAM has been written since the last save.
+	Unsaved() bool
+	// RAM has been disabled after being written, games do this when they finish saving.
+	FlushRequested() bool
+}
+
+// Tracks unsaved changes to cart RAM. Embedded by the mappers.
+type batteryRAM struct {
+	unsaved        bool
+	flushRequested bool
+}
+
+func (b *batteryRAM) ramWritten() {
+	b.unsaved = true
+}
+
+func (b *batteryRAM) ramDisabled() {
+	if b.unsaved {
+		b.flushRequested = true
+	}
+}
+
+func (b *batteryRAM) saved() {
+	b.unsaved = false
+	b.flushRequested = false
+}
+
+func (b *batteryRAM) Unsaved() bool {
+	return b.unsaved
+}
+
+func (b *batteryRAM) FlushRequested() bool {
+	return b.flushRequested
+}
+
+// The save file sits next to the rom, with the extension swapped for .sav, same as other emulators.
+func SavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+// Returns the cart as a BatteryCart if its header says it has a battery.
+func batteryCart(cart Cartridge) (BatteryCart, bool) {
+	b, ok := cart.(BatteryCart)
+	if !ok || cart.Header() == nil || !cart.Header().HasBattery() {
+		return nil, false
+	}
+	return b, true
+}
+
+// Load the save file into cart RAM. A missing save file is not an error.
+func LoadBatterySave(cart Cartridge, path string) error {
+	b, ok := batteryCart(cart)
+	if !ok {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	b.LoadSaveData(data)
+	return nil
+}
+
+// Write cart RAM to the save file. Writes to a temporary file first so a crash can't leave a half written save.
+func WriteBatterySave(cart Cartridge, path string) error {
+	b, ok := batteryCart(cart)
+	if !ok {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.SaveData(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,133 @@
+package gameboy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSavePath(t *testing.T) {
+	testCases := []struct {
+		rom, want string
+	}{
+		{rom: "roms/zelda.gb", want: "roms/zelda.sav"},
+		{rom: "pokemon.gbc", want: "pokemon.sav"},
+		{rom: "noext", want: "noext.sav"},
+	}
+
+	for _, tt := range testCases {
+		if got := SavePath(tt.rom); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.rom, tt.want, got)
+		}
+	}
+}
+
+func TestBatterySaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	cart, err := NewCartridge(newTestHeaderRom(0x03, 0x02, 0x03)) // MBC1+RAM+BATTERY, 32 KiB
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart.Write(0x0000, 0x0A)
+	cart.Write(0x6000, 0x01)
+	cart.Write(0x4000, 0x02)
+	cart.Write(0xA000, 0x42)
+
+	b := cart.(BatteryCart)
+	if !b.Unsaved() || b.FlushRequested() {
+		t.Errorf("RAM write should be unsaved without requesting a flush")
+	}
+
+	cart.Write(0x0000, 0x00)
+	if !b.FlushRequested() {
+		t.Errorf("disabling RAM after a write should request a flush")
+	}
+
+	if err := WriteBatterySave(cart, path); err != nil {
+		t.Fatal(err)
+	}
+	if b.Unsaved() {
+		t.Errorf("RAM should be marked as saved")
+	}
+
+	data, _ := os.ReadFile(path)
+	if len(data) != 0x8000 {
+		t.Errorf("save should be raw RAM, want 0x%X bytes, got 0x%X", 0x8000, len(data))
+	}
+
+	loaded, _ := NewCartridge(newTestHeaderRom(0x03, 0x02, 0x03))
+	if err := LoadBatterySave(loaded, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Write(0x0000, 0x0A)
+	loaded.Write(0x6000, 0x01)
+	loaded.Write(0x4000, 0x02)
+	if got := loaded.Read(0xA000); got != 0x42 {
+		t.Errorf("want 0x42 from save file, got 0x%02X", got)
+	}
+}
+
+func TestBatterySaveWithoutBattery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	cart, _ := NewCartridge(newTestHeaderRom(0x02, 0x02, 0x02)) // MBC1+RAM
+	cart.Write(0x0000, 0x0A)
+	cart.Write(0xA000, 0x42)
+
+	if err := WriteBatterySave(cart, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("cart without battery should not write a save file")
+	}
+
+	// Missing save file is fine
+	if err := LoadBatterySave(cart, filepath.Join(t.TempDir(), "missing.sav")); err != nil {
+		t.Errorf("missing save should not be an error, got %v", err)
+	}
+}
+
+func TestMBC3SaveFooter(t *testing.T) {
+	clock := &fakeTime{now: time.Unix(1700000000, 0)}
+	c := newTestMBC3(0x10, clock)
+	c.Write(0x0000, 0x0A)
+	c.Write(0x4000, 0x00)
+	c.Write(0xA000, 0x99)
+	writeRTC(c, RTC_M, 10)
+	latchRTC(c)
+
+	data := c.SaveData()
+	if len(data) != 0x8000+RTC_FOOTER_SIZE {
+		t.Fatalf("want RAM + 48 byte footer, got %d bytes", len(data))
+	}
+
+	// Load an hour later
+	clock.Advance(time.Hour)
+	loaded := newTestMBC3(0x10, clock)
+	loaded.LoadSaveData(data)
+	loaded.Write(0x0000, 0x0A)
+
+	loaded.Write(0x4000, 0x00)
+	if got := loaded.Read(0xA000); got != 0x99 {
+		t.Errorf("want RAM 0x99, got 0x%02X", got)
+	}
+	if got := readRTC(loaded, RTC_M); got != 10 {
+		t.Errorf("latched minutes should be restored, want 10, got %d", got)
+	}
+	latchRTC(loaded)
+	if h, m := readRTC(loaded, RTC_H), readRTC(loaded, RTC_M); h != 1 || m != 10 {
+		t.Errorf("clock should catch up on time since the save, want 1h10m, got %dh%dm", h, m)
+	}
+
+	// 44 byte footer with a 32 bit timestamp
+	short := append(data[:0x8000+40:0x8000+40], data[0x8000+40:0x8000+44]...)
+	loaded = newTestMBC3(0x10, clock)
+	loaded.LoadSaveData(short)
+	loaded.Write(0x0000, 0x0A)
+	latchRTC(loaded)
+	if h, m := readRTC(loaded, RTC_H), readRTC(loaded, RTC_M); h != 1 || m != 10 {
+		t.Errorf("44 byte footer: want 1h10m, got %dh%dm", h, m)
+	}
+}
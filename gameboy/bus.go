@@ -1,7 +1,6 @@
-package main
+package gameboy
 
 import (
-	"fmt"
 	"log"
 
 	utils "github.com/mikzorz/goboy-emu/helpers"
@@ -12,37 +11,29 @@ type BusI interface {
 	Write(uint16, byte)
 	isHalted() bool
 	setHalt(bool)
+	stop()
 }
 
 type Bus struct {
-	cart  *Cart
+	cart  Cartridge
 	cpu   *CPU
 	ppu   *PPU
 	dma   *DMA
 	clock *Clock
 	lcd   *LCD
 	// lcd    LCDI
-	joypad *Joypad
-	wram   [0x2000]byte
-	hram   [0x7F]byte
-	SB     byte // Serial Transfer Data
-	SC     byte // Serial Transfer Control
-	// Sound
-	NR10           byte
-	NR11           byte
-	NR12           byte
-	NR13           byte
-	NR14           byte
-	NR32           byte
-	NR50           byte
-	NR51           byte
-	NR52           byte // sound on/off
-	halted         bool
-	screenDisabled bool // for automated tests
-	alwaysVblank   bool // LY will always return 0x90, for when it's useful
+	joypad       *Joypad
+	apu          *APU
+	wram         [0x2000]byte
+	hram         [0x7F]byte
+	serial       *Serial
+	halted       bool
+	stopped      bool   // STOP, CPU and timer wait for a button press
+	bootROM      []byte // mapped over 0000-00FF, nil once FF50 is written
+	alwaysVblank bool   // LY will always return 0x90, for when it's useful
 }
 
-func NewBus(cart *Cart) *Bus {
+func NewBus(cart Cartridge) *Bus {
 	wram := [0x2000]byte{}
 	hram := [0x7F]byte{}
 	b := &Bus{
@@ -51,22 +42,20 @@ func NewBus(cart *Cart) *Bus {
 		ppu:    NewPPU(),
 		dma:    NewDMA(),
 		clock:  NewClock(),
-		lcd:    NewLCD(),
+		lcd:    NewLCD(SCREEN_WIDTH),
 		joypad: NewJoypad(),
+		apu:    NewAPU(),
+		serial: NewSerial(),
 		wram:   wram,
 		hram:   hram,
-
-		NR10: 0x80,
-		NR11: 0xBF,
-		NR12: 0xF3,
-		NR13: 0xFF,
-		NR14: 0xBF,
 	}
-	cart.bus = b
 	b.cpu.bus = b
 	b.ppu.bus = b
 	b.dma.bus = b
 	b.clock.bus = b
+	b.apu.bus = b
+	b.joypad.bus = b
+	b.serial.bus = b
 	b.lcd.SetBus(b)
 
 	bgFIFO := NewFIFO()
@@ -82,7 +71,9 @@ func NewBus(cart *Cart) *Bus {
 func (b *Bus) Cycle() {
 
 	if b.clock.sysClock%4 == 0 {
-		b.cpu.Cycle()
+		if !b.stopped {
+			b.cpu.Cycle()
+		}
 		b.dma.Cycle()
 	}
 
@@ -91,7 +82,12 @@ func (b *Bus) Cycle() {
 	b.lcd.Cycle()
 
 	b.clock.sysClock++
-	b.clock.Cycle()
+	if !b.stopped {
+		b.clock.Cycle()
+	}
+	b.serial.Cycle()
+
+	b.apu.Cycle()
 }
 
 func (b *Bus) Read(addr uint16) byte {
@@ -104,6 +100,9 @@ func (b *Bus) Read(addr uint16) byte {
 		}
 	} else {
 		switch {
+		case addr <= 0x00FF && b.bootROM != nil:
+			// 0000-00FF, boot rom until FF50 is written
+			return b.bootROM[addr]
 		case addr <= 0x7FFF:
 			// 0000-3FFF, cart bank X0
 			// 4000-7FFF, cart bank 01-NN
@@ -148,10 +147,8 @@ func (b *Bus) ReadIO(addr uint16) byte {
 	case 0xFF00:
 		// Joypad Buttons
 		return b.joypad.Read()
-	case 0xFF01:
-		return b.SB
-	case 0xFF02:
-		return b.SC | 0x7E
+	case 0xFF01, 0xFF02:
+		return b.serial.Read(addr)
 	case 0xFF04:
 		return utils.MSB(b.clock.DIV)
 	case 0xFF05:
@@ -162,39 +159,11 @@ func (b *Bus) ReadIO(addr uint16) byte {
 		return b.clock.TAC&0x7 | 0xF8
 	case 0xFF0F:
 		return b.cpu.IF | 0xE0
-		//  // case 0xFF1C:
-		//  //   return b.NR32
-	case 0xFF10:
-		// Channel 1 audio
-		return b.NR10
-	case 0xFF11:
-		return b.NR11
-	case 0xFF12:
-		return b.NR12
-	case 0xFF13:
-		return b.NR13
-	case 0xFF14:
-		return b.NR14
-	case 0xFF16, 0xFF17, 0xFF18, 0xFF19:
-		// Channel 2 audio
-		return 0
-	case 0xFF1A, 0xFF1B, 0xFF1C, 0xFF1D, 0xFF1E:
-		// Channel 3 audio
-		return 0
-	case 0xFF20, 0xFF21, 0xFF22, 0xFF23:
-		// Channel 4 audio
-		return 0
-	case 0xFF24:
-		return b.NR50
-	case 0xFF25:
-		return b.NR51
-	case 0xFF26:
-		return b.NR52
 	case 0xFF40:
-		// TODO, bit 7 should always return 1, bits 0-2 return 0 if LCD is off.
+		// All 8 bits read back as written, even with the LCD off
 		return b.ppu.LCDC
 	case 0xFF41:
-		return b.ppu.STAT
+		return b.ppu.STAT | 0x80
 	case 0xFF42:
 		return b.ppu.SCY
 	case 0xFF43:
@@ -203,7 +172,7 @@ func (b *Bus) ReadIO(addr uint16) byte {
 		if b.alwaysVblank {
 			return 0x90
 		}
-		return b.ppu.LY
+		return b.ppu.readLY()
 	case 0xFF45:
 		return b.ppu.LYC
 	case 0xFF46:
@@ -218,13 +187,16 @@ func (b *Bus) ReadIO(addr uint16) byte {
 		return b.ppu.WY
 	case 0xFF4B:
 		return b.ppu.WX // TODO sub 7?
-	case 0xFF03, 0xFF08, 0xFF09, 0xFF0A, 0xFF0B, 0xFF0C, 0xFF0D, 0xFF0E, 0xFF15, 0xFF1F, 0xFF4C:
+	case 0xFF03, 0xFF08, 0xFF09, 0xFF0A, 0xFF0B, 0xFF0C, 0xFF0D, 0xFF0E, 0xFF4C:
 		// undocumented
 		return 0xFF
+	case 0xFF50:
+		// boot rom disable, write only
+		return 0xFF
 	default:
-		// FF30-FF3F = wave ram?
-		if addr >= 0xFF27 && addr <= 0xFF3F {
-			return 0
+		if addr >= 0xFF10 && addr <= 0xFF3F {
+			// Audio and wave RAM
+			return b.apu.Read(addr)
 		}
 		if addr >= 0xFF4D {
 			// some CGB-only registers
@@ -262,14 +234,8 @@ func (b *Bus) Write(addr uint16, data byte) {
 			switch addr {
 			case 0xFF00:
 				b.joypad.Write(data)
-			case 0xFF01:
-				b.SB = data
-			case 0xFF02:
-				b.SC = data
-				if DEV && b.SC == 0x81 { // blargg's test rom serial output
-					fmt.Println(string(rune(b.SB)))
-					b.SC = 0x0
-				}
+			case 0xFF01, 0xFF02:
+				b.serial.Write(addr, data)
 			case 0xFF04:
 				b.clock.DIV = 0x0000
 			case 0xFF05:
@@ -290,39 +256,10 @@ func (b *Bus) Write(addr uint16, data byte) {
 				b.clock.TAC = data & 0x7
 			case 0xFF0F:
 				b.cpu.IF = data
-			case 0xFF10, 0xFF11, 0xFF12, 0xFF13, 0xFF14:
-				// Channel 1 audio
-				break
-			case 0xFF16, 0xFF17, 0xFF18, 0xFF19:
-				// Channel 2 audio
-				break
-			case 0xFF1A, 0xFF1B, 0xFF1C, 0xFF1D, 0xFF1E:
-				// Channel 3 audio
-				break
-			case 0xFF20, 0xFF21, 0xFF22, 0xFF23:
-				// Channel 4 audio
-				break
-			// case 0xFF16, 0xFF17, 0xFF18:
-			// 	// TODO Channel 2 sound length/wave pattern duty
-			// 	break
-			// case 0xFF19:
-			// 	// TODO Channel 2 freq hi data
-			// 	break
-			case 0xFF24:
-				b.NR50 = data
-			case 0xFF25:
-				b.NR51 = data
-			case 0xFF26:
-				if utils.IsBitSet(7, data) {
-					b.NR52 = 0
-				} else {
-					// Bits 0-3 are read only.
-					b.NR52 = (data & 0xF0) | (b.NR52 & 0xF)
-				}
 			case 0xFF40:
-				b.ppu.LCDC = data
+				b.ppu.setLCDC(data)
 			case 0xFF41:
-				b.ppu.STAT = data
+				b.ppu.writeSTAT(data)
 			case 0xFF42:
 				b.ppu.SCY = data
 			case 0xFF43:
@@ -330,10 +267,8 @@ func (b *Bus) Write(addr uint16, data byte) {
 			case 0xFF44:
 				b.ppu.LY = 0
 			case 0xFF45:
+				// STAT.2 follows on the next dot
 				b.ppu.LYC = data
-				if b.ppu.LYC == b.ppu.LY {
-					b.ppu.STAT |= 0x2
-				}
 			case 0xFF46:
 				b.dma.StartOAMTransfer(data)
 			case 0xFF47:
@@ -346,17 +281,23 @@ func (b *Bus) Write(addr uint16, data byte) {
 				b.ppu.WY = data
 			case 0xFF4B:
 				b.ppu.WX = data
+			case 0xFF50:
+				if data != 0 {
+					b.bootROM = nil
+				}
 			case 0xFFFF:
 				b.cpu.IE = data
 				// case 0xff03:
 				// ff0x may refer to lower byte of DIV
 				//   b.clock.DIV = 0
 			// case 0xFF03, 0xFF08, 0xFF09, 0xFF0A, 0xFF0B, 0xFF0C, 0xFF0D, 0xFF0E, 0xFF15, 0xFF1F, 0xFF4C:
-			case 0xFF08, 0xFF09, 0xFF0A, 0xFF0B, 0xFF0C, 0xFF0D, 0xFF0E, 0xFF15, 0xFF1F, 0xFF4C:
+			case 0xFF08, 0xFF09, 0xFF0A, 0xFF0B, 0xFF0C, 0xFF0D, 0xFF0E, 0xFF4C:
 				// undocumented
 				break
 			default:
-				if addr >= 0xFF27 && addr <= 0xFF3F {
+				if addr >= 0xFF10 && addr <= 0xFF3F {
+					// Audio and wave RAM
+					b.apu.Write(addr, data)
 					break
 				}
 				if addr >= 0xFF4D {
@@ -377,6 +318,26 @@ func (b *Bus) setHalt(v bool) {
 	b.halted = v
 }
 
+// Power on into the boot rom instead of the state it leaves behind.
+func (b *Bus) coldBoot(bootROM []byte) {
+	b.bootROM = bootROM
+	b.cpu.RegisterFile = RegisterFile{}
+	b.clock.DIV = 0
+	b.ppu.setLCDC(0)
+	b.ppu.BGP, b.ppu.OBP0, b.ppu.OBP1 = 0, 0, 0
+	b.apu = newAPU()
+	b.apu.bus = b
+}
+
+// Enter STOP mode, unless a selected button is already held. DIV is reset and stays at 0 until a press.
+func (b *Bus) stop() {
+	if b.joypad.output() != 0xF {
+		return
+	}
+	b.stopped = true
+	b.clock.DIV = 0x0000
+}
+
 type interrupt int
 
 const (
@@ -1,24 +1,26 @@
-package main
+package gameboy
 
 import (
 	utils "github.com/mikzorz/goboy-emu/helpers"
 )
 
+// MBC1 cartridge
 type Cart struct {
 	rom           []byte
 	bank          byte
 	secondaryBank byte
-	ram           [0x2000]byte
-	bus           *Bus
+	ram           []byte // sized from the cartridge header, 0x2000 bytes per bank
+	ramEnabled    bool
+	header        *CartHeader
+	batteryRAM
 
 	bankingMode byte // 0 or 1
 
-	numOfBanks byte
+	numOfBanks int
 }
 
 func NewCart() *Cart {
 	return &Cart{
-		ram:  [0x2000]byte{},
 		bank: 1,
 	}
 }
@@ -33,7 +35,14 @@ func (c *Cart) LoadROMData(data []byte) {
 	if len(c.rom)%0x4000 != 0 {
 		numOfBanks++
 	}
-	c.numOfBanks = byte(numOfBanks)
+	c.numOfBanks = max(numOfBanks, 1)
+
+	ramSize := 0
+	if header, err := ParseHeader(c.rom); err == nil {
+		c.header = header
+		ramSize = header.RAMBytes()
+	}
+	c.ram = make([]byte, ramSize)
 }
 
 func (c *Cart) SwitchBank(data byte) {
@@ -48,17 +57,21 @@ func (c *Cart) Read(addr uint16) byte {
 	if addr <= 0x3FFF {
 		if c.bankingMode == 1 {
 			bank := c.secondaryBank << 5
-			bank %= c.numOfBanks
+			bank = byte(int(bank) % c.numOfBanks)
 			return c.rom[uint(addr)+c.getBankAddressOffset(bank)]
 		} else {
 			return c.rom[addr]
 		}
 	} else if addr <= 0x7FFF {
 		bank := c.bank | (c.secondaryBank << 5) // In MBC1 multicart, shift 4 instead of 5, original bit.4 is ignored
-		bank %= c.numOfBanks
+		bank = byte(int(bank) % c.numOfBanks)
 		return c.rom[uint(addr-0x4000)+c.getBankAddressOffset(bank)]
 	} else {
-		return c.ram[addr-0xA000]
+		if !c.ramEnabled || len(c.ram) == 0 {
+			// Open bus
+			return 0xFF
+		}
+		return c.ram[c.getRAMAddress(addr)]
 	}
 }
 
@@ -75,16 +88,18 @@ func (c *Cart) Write(addr uint16, data byte) {
 		// Banking Mode
 		c.setBankingMode(data)
 	case (addr >= 0xA000 && addr <= 0xBFFF):
-		c.ram[addr-0xA000] = data // TODO ram banking
+		if c.ramEnabled && len(c.ram) > 0 {
+			c.ram[c.getRAMAddress(addr)] = data
+			c.ramWritten()
+		}
 	}
 }
 
+// Any value with 0xA in the lower nibble enables cart RAM, anything else disables it.
 func (c *Cart) setRAMEnable(data byte) {
-	if data == 0x0A {
-		// TODO
-		// enable cart RAM
-	} else {
-		// disable cart RAM
+	c.ramEnabled = data&0xF == 0xA
+	if !c.ramEnabled {
+		c.ramDisabled()
 	}
 }
 
@@ -94,6 +109,30 @@ func (c *Cart) setBankingMode(data byte) {
 	c.bankingMode = utils.GetBit(0, data)
 }
 
+func (c *Cart) Header() *CartHeader {
+	return c.header
+}
+
+func (c *Cart) SaveData() []byte {
+	c.saved()
+	return append([]byte{}, c.ram...)
+}
+
+func (c *Cart) LoadSaveData(data []byte) {
+	copy(c.ram, data)
+}
+
 func (c *Cart) getBankAddressOffset(bank byte) uint {
 	return uint(bank) * 0x4000
 }
+
+// Translate an address in A000-BFFF to an index of c.ram.
+// In banking mode 1, the secondary bank register selects one of 4 RAM banks.
+// Carts with 8 KiB of RAM or less ignore the bank, out of range accesses wrap around.
+func (c *Cart) getRAMAddress(addr uint16) int {
+	bank := 0
+	if c.bankingMode == 1 {
+		bank = int(c.secondaryBank)
+	}
+	return (bank*0x2000 + int(addr-0xA000)) % len(c.ram)
+}
@@ -0,0 +1,81 @@
+package gameboy
+
+import (
+	"testing"
+)
+
+// Build a rom of the given amount of 16 KiB banks, with the RAM size byte set in the header.
+func newTestCartRom(banks int, ramSize byte) []byte {
+	rom := make([]byte, banks*0x4000)
+	rom[0x149] = ramSize
+	return rom
+}
+
+func TestCartRAMEnable(t *testing.T) {
+	cart := NewCart()
+	cart.LoadROMData(newTestCartRom(4, 0x02))
+
+	cart.Write(0xA000, 0x12)
+	if got := cart.Read(0xA000); got != 0xFF {
+		t.Errorf("disabled RAM should read 0xFF, got 0x%02X", got)
+	}
+
+	cart.Write(0x0000, 0x0A)
+	cart.Write(0xA000, 0x34)
+	if got := cart.Read(0xA000); got != 0x34 {
+		t.Errorf("enabled RAM should read 0x%02X, got 0x%02X", 0x34, got)
+	}
+
+	cart.Write(0x0000, 0x00)
+	if got := cart.Read(0xA000); got != 0xFF {
+		t.Errorf("RAM should read 0xFF after being disabled, got 0x%02X", got)
+	}
+
+	// Only the lower nibble matters
+	cart.Write(0x1FFF, 0xFA)
+	if got := cart.Read(0xA000); got != 0x34 {
+		t.Errorf("RAM should keep its data while disabled, want 0x%02X, got 0x%02X", 0x34, got)
+	}
+}
+
+func TestCartRAMBanking(t *testing.T) {
+	cart := NewCart()
+	cart.LoadROMData(newTestCartRom(4, 0x03))
+
+	if len(cart.ram) != 0x8000 {
+		t.Fatalf("RAM should be sized from header, want 0x%X bytes, got 0x%X", 0x8000, len(cart.ram))
+	}
+
+	cart.Write(0x0000, 0x0A)
+	cart.Write(0x6000, 0x01) // banking mode 1
+
+	for bank := byte(0); bank < 4; bank++ {
+		cart.Write(0x4000, bank)
+		cart.Write(0xA123, 0x10+bank)
+	}
+
+	for bank := byte(0); bank < 4; bank++ {
+		cart.Write(0x4000, bank)
+		if got := cart.Read(0xA123); got != 0x10+bank {
+			t.Errorf("bank %d: want 0x%02X, got 0x%02X", bank, 0x10+bank, got)
+		}
+	}
+
+	// Banking mode 0 locks A000-BFFF to bank 0
+	cart.Write(0x4000, 0x03)
+	cart.Write(0x6000, 0x00)
+	if got := cart.Read(0xA123); got != 0x10 {
+		t.Errorf("mode 0 should read bank 0, want 0x%02X, got 0x%02X", 0x10, got)
+	}
+}
+
+func TestCartNoRAM(t *testing.T) {
+	cart := NewCart()
+	cart.LoadROMData(newTestCartRom(2, 0x00))
+
+	cart.Write(0x0000, 0x0A)
+	cart.Write(0xA000, 0x12)
+	if got := cart.Read(0xA000); got != 0xFF {
+		t.Errorf("cart without RAM should read 0xFF, got 0x%02X", got)
+	}
+}
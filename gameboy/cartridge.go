@@ -0,0 +1,119 @@
+package gameboy
+
+import (
+	"fmt"
+	"log"
+)
+
+// Common interface for all cartridge mappers.
+// Bus forwards 0000-7FFF and A000-BFFF to the cartridge.
+type Cartridge interface {
+	Read(uint16) byte
+	Write(uint16, byte)
+	Header() *CartHeader
+	// Banking registers and RAM, for save states
+	state() cartState
+	loadState(cartState)
+}
+
+// Parse the header of rom and return the matching mapper.
+// Unsupported cartridge types return an error instead of being treated as MBC1.
+func NewCartridge(rom []byte) (Cartridge, error) {
+	header, err := ParseHeader(rom)
+	if err != nil {
+		return nil, err
+	}
+
+	if !header.HeaderChecksumOK() {
+		log.Printf("warning: header checksum mismatch, a real DMG would refuse to boot this rom")
+	}
+	if banks := header.ROMBanks(); banks*0x4000 != len(rom) {
+		log.Printf("warning: header declares %d ROM banks (%d bytes), file is %d bytes", banks, banks*0x4000, len(rom))
+		rom = padROM(rom, banks*0x4000)
+	}
+	if header.CGBFlag == 0xC0 {
+		log.Printf("warning: %q is CGB only and may not run on a DMG", header.Title)
+	}
+
+	switch header.Mapper() {
+	case MAPPER_NONE:
+		return NewROMOnly(rom, header), nil
+	case MAPPER_MBC1:
+		c := NewCart()
+		c.LoadROMData(rom)
+		return c, nil
+	case MAPPER_MBC2:
+		return NewMBC2(rom, header), nil
+	case MAPPER_MBC3:
+		return NewMBC3(rom, header, systemTime{}), nil
+	case MAPPER_MBC5:
+		return NewMBC5(rom, header), nil
+	default:
+		return nil, fmt.Errorf("unsupported cartridge type 0x%02X (%s)", header.CartType, header.Mapper())
+	}
+}
+
+// Pad rom with 0xFF (open bus) to size and to whole 16 KiB banks, so that
+// the mappers never read past the end of a truncated file.
+func padROM(rom []byte, size int) []byte {
+	size = max(size, (len(rom)+0x3FFF)/0x4000*0x4000)
+	if size <= len(rom) {
+		return rom
+	}
+	padded := make([]byte, size)
+	copy(padded, rom)
+	for i := len(rom); i < size; i++ {
+		padded[i] = 0xFF
+	}
+	return padded
+}
+
+// 32 KiB cart with no mapper, optionally with up to 8 KiB of RAM.
+type ROMOnly struct {
+	rom    []byte
+	ram    []byte
+	header *CartHeader
+	batteryRAM
+}
+
+func NewROMOnly(rom []byte, header *CartHeader) *ROMOnly {
+	c := &ROMOnly{
+		rom:    rom,
+		header: header,
+	}
+	if header.HasRAM() {
+		c.ram = make([]byte, min(header.RAMBytes(), 0x2000))
+	}
+	return c
+}
+
+func (c *ROMOnly) Read(addr uint16) byte {
+	if addr <= 0x7FFF {
+		if int(addr) < len(c.rom) {
+			return c.rom[addr]
+		}
+	} else if int(addr-0xA000) < len(c.ram) {
+		return c.ram[addr-0xA000]
+	}
+	return 0xFF
+}
+
+func (c *ROMOnly) Write(addr uint16, data byte) {
+	if addr >= 0xA000 && int(addr-0xA000) < len(c.ram) {
+		c.ram[addr-0xA000] = data
+		c.ramWritten()
+	}
+}
+
+func (c *ROMOnly) Header() *CartHeader {
+	return c.header
+}
+
+func (c *ROMOnly) SaveData() []byte {
+	c.saved()
+	return append([]byte{}, c.ram...)
+}
+
+func (c *ROMOnly) LoadSaveData(data []byte) {
+	copy(c.ram, data)
+}
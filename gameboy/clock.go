@@ -1,9 +1,12 @@
-package main
+package gameboy
 
 import (
 	utils "github.com/mikzorz/goboy-emu/helpers"
 )
 
+// System clock speed in Hz
+const CLOCK_SPEED = 4194304
+
 type Clock struct {
 	bus     *Bus
 	speed   uint   // 4194304 Hz / 2^22 Hz
@@ -29,7 +32,7 @@ const (
 
 func NewClock() *Clock {
 	return &Clock{
-		speed:     4194304,
+		speed:     CLOCK_SPEED,
 		DIV:       0xABCC, // according to cycle accurate docs
 		TIMAState: TIMA_NO_OVERFLOW,
 	}
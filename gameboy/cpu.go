@@ -1,9 +1,10 @@
-package main
+package gameboy
 
 import (
 	"fmt"
 	"github.com/mikzorz/goboy-emu/alu"
 	utils "github.com/mikzorz/goboy-emu/helpers"
+	"io"
 	"log"
 )
 
@@ -63,7 +64,9 @@ type CPU struct {
 	setIME      bool // IME setting is delayed 1 cycle
 	untilIME    int
 	haltBug     bool
-	skipLog     bool // for Gameboy Doctor, to not log after moving to interrupt vector
+	skipLog     bool      // for Gameboy Doctor, to not log after moving to interrupt vector
+	doctorLog   io.Writer // Gameboy Doctor log, nil to disable
+	fetches     uint      // instructions fetched, for stepping by instruction
 }
 
 func NewCPU() *CPU {
@@ -114,62 +117,78 @@ func (c *CPU) DecodePrefix() {
 	// Wouldn't that cause incorrect functions to run after a RET?
 	c.FetchIR(true)
 
-	c.opFunc = func() {
-		if c.curCycle == 0 {
-			c.Read()
-			return
-		}
-
-		if c.curCycle == 1 || c.inst.To != mHL {
-			switch c.inst.Op {
-			case "SWAP":
-				c.Swap()
-			case "BIT":
-				c.Bit()
-				c.DecodeOp()
-				return
-			case "RES":
-				c.Res()
-			case "SET":
-				c.Set()
-			case "SRA":
-				c.SRA()
-			case "SLA":
-				c.SLA()
-			case "SRL":
-				c.SRL()
-			case "RR":
-				c.RR()
-			case "RRC":
-				c.RRC()
-			case "RL":
-				c.RL()
-			case "RLC":
-				c.RLC()
-			default:
-				log.Panicf("unimplemented PREFIXED op: %s/0x%02X, dt: %v, to: %s, from: %s, flag: %s", c.inst.Op, c.IR, c.inst.DataType, c.inst.To, c.inst.From, c.inst.Flag)
-			}
+	c.opFunc = c.PrefixOp
+}
 
-			if c.inst.To != mHL {
-				c.SetRegister()
-				c.DecodeOp()
-			} else {
-				c.Write()
+// Execute a cycle of the prefixed op fetched by DecodePrefix
+func (c *CPU) PrefixOp() {
+	if c.curCycle == 0 {
+		c.Read()
+		return
+	}
 
-			}
+	if c.curCycle == 1 || c.inst.To != mHL {
+		switch c.inst.Op {
+		case "SWAP":
+			c.Swap()
+		case "BIT":
+			c.Bit()
+			c.DecodeOp()
 			return
+		case "RES":
+			c.Res()
+		case "SET":
+			c.Set()
+		case "SRA":
+			c.SRA()
+		case "SLA":
+			c.SLA()
+		case "SRL":
+			c.SRL()
+		case "RR":
+			c.RR()
+		case "RRC":
+			c.RRC()
+		case "RL":
+			c.RL()
+		case "RLC":
+			c.RLC()
+		default:
+			log.Panicf("unimplemented PREFIXED op: %s/0x%02X, dt: %v, to: %s, from: %s, flag: %s", c.inst.Op, c.IR, c.inst.DataType, c.inst.To, c.inst.From, c.inst.Flag)
 		}
 
-		if c.curCycle == 2 {
+		if c.inst.To != mHL {
+			c.SetRegister()
 			c.DecodeOp()
+		} else {
+			c.Write()
+
 		}
+		return
+	}
+
+	if c.curCycle == 2 {
+		c.DecodeOp()
+	}
+}
+
+// opFunc is not saved in save states, it is rebuilt from the current instruction.
+// Interrupt dispatch and prefixed ops are set outside of SetOpFunc, everything else goes through it.
+func (c *CPU) restoreOpFunc() {
+	switch {
+	case c.inst.Op == "INT":
+		c.opFunc = c.MoveToInterrupt
+	case c.inst.Prefixed:
+		c.opFunc = c.PrefixOp
+	default:
+		c.SetOpFunc()
 	}
 }
 
 func (c *CPU) CheckInterrupts() (interrupted bool) {
 	// According to a reddit comment, normal cpu cycle is T-cycle 1, but interrupt checks are during T3?
 	// Check interrupt bytes
-	if c.IF != 0 && c.IE != 0 {
+	if c.IF&c.IE&0x1F != 0 {
 		c.bus.setHalt(false)
 		if c.IME == 1 {
 			for bit := 0; bit <= 4; bit++ {
@@ -1073,7 +1092,7 @@ func (c *CPU) Fetch(hilo register) {
 }
 
 func (c *CPU) FetchIR(prefix bool) (interrupted bool) {
-	if GAMEBOY_DOCTOR && !prefix && !c.skipLog {
+	if c.doctorLog != nil && !prefix && !c.skipLog {
 		// c := b.cpu
 		B := utils.MSB(c.BC)
 		C := utils.LSB(c.BC)
@@ -1085,7 +1104,7 @@ func (c *CPU) FetchIR(prefix bool) (interrupted bool) {
 		for i := 0; i < 4; i++ {
 			pcm = append(pcm, c.bus.Read(c.PC+uint16(i)))
 		}
-		fmt.Fprintf(logfile, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n", c.A, c.F, B, C, D, E, H, L, c.SP, c.PC, pcm[0], pcm[1], pcm[2], pcm[3])
+		fmt.Fprintf(c.doctorLog, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n", c.A, c.F, B, C, D, E, H, L, c.SP, c.PC, pcm[0], pcm[1], pcm[2], pcm[3])
 	}
 
 	c.curCycle = 0xFF // after fetch, will be incremented to 0
@@ -1094,6 +1113,9 @@ func (c *CPU) FetchIR(prefix bool) (interrupted bool) {
 		return true
 	}
 
+	if !prefix {
+		c.fetches++
+	}
 	c.instAddr = c.PC
 	c.IR = c.imm8()
 
@@ -1125,10 +1147,11 @@ func (c *CPU) DecodeOp() {
 func (c *CPU) SetOpFunc() {
 	switch c.inst.Op {
 	case "STOP":
-		// c.bus.halted = true
-		// c.bus.DIV = 0
-		c.opFunc = c.NOP
-		// TODO, STOP does a lot more than NOP, but this is here just to pass blargg's cpu_instrs test. CGB needs it for speed switching, DMG not so much.
+		// Waits for a button press, see Bus.stop. CGB speed switching is not needed on DMG.
+		c.opFunc = func() {
+			c.bus.stop()
+			c.DecodeOp()
+		}
 	case "NOP":
 		c.opFunc = c.NOP
 	case "HALT":
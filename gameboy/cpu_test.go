@@ -1,4 +1,4 @@
-package main
+package gameboy
 
 import (
 	"fmt"
@@ -245,6 +245,8 @@ func (b *busStub) setHalt(v bool) {
 	// b.halted = v
 }
 
+func (b *busStub) stop() {}
+
 func (b *busStub) printLogs() {
 	for _, s := range b.log {
 		fmt.Println(s)
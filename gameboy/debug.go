@@ -0,0 +1,141 @@
+package gameboy
+
+import (
+	"fmt"
+	"log"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Read-only views of the machine, for debuggers.
+
+type PPUInfo struct {
+	Dot              int
+	X, LCDX          byte // fetcher x, LCD x
+	SCX, SCY, WX, WY byte
+	LCDC, BGP, LY    byte
+	Mode             string
+	DMA              bool
+}
+
+type TimerInfo struct {
+	DIV            uint16
+	TIMA, TMA, TAC byte
+}
+
+func (m *Machine) Registers() RegisterFile {
+	return m.bus.cpu.RegisterFile
+}
+
+// Read from the bus, as the CPU would.
+func (m *Machine) Read(addr uint16) byte {
+	return m.bus.Read(addr)
+}
+
+func (m *Machine) VRAM() []byte {
+	return m.bus.ppu.vram[:]
+}
+
+func (m *Machine) OAM() []byte {
+	return m.bus.dma.oam[:]
+}
+
+func (m *Machine) PPU() PPUInfo {
+	p := m.bus.ppu
+	return PPUInfo{
+		Dot:  p.dot,
+		X:    p.x,
+		LCDX: m.bus.lcd.GetX(),
+		SCX:  p.SCX,
+		SCY:  p.SCY,
+		WX:   p.WX,
+		WY:   p.WY,
+		LCDC: p.LCDC,
+		BGP:  p.BGP,
+		LY:   m.bus.Read(0xFF44),
+		Mode: string(p.mode),
+		DMA:  m.bus.dma.oamDMA,
+	}
+}
+
+func (m *Machine) Timers() TimerInfo {
+	c := m.bus.clock
+	return TimerInfo{DIV: c.DIV, TIMA: c.TIMA, TMA: c.TMA, TAC: c.TAC}
+}
+
+// Address and opcode of the instruction that was just fetched, i.e. after StepInstruction.
+func (m *Machine) Opcode() (addr uint16, op byte) {
+	return m.bus.cpu.instAddr, m.bus.cpu.IR
+}
+
+// The instruction being executed, with opcode and arguments, e.g. "0150: LD HL 8000".
+func (m *Machine) CurrentInstruction() string {
+	b := m.bus
+	inst := b.cpu.inst
+	instOp := inst.Op
+	instAddr := b.cpu.instAddr
+
+	t := inst.To
+	f := inst.From
+
+	// depending on instruction, figure out how many args to read, starting at current PC
+	s := fmt.Sprintf("%04X: %s", instAddr, instOp)
+
+	switch dt := inst.DataType; dt {
+	case NODATA:
+		// Either no args, or args are registers / absolute values
+		if instOp == "RET" && inst.Flag != NOFLAG {
+			// RET
+			s += fmt.Sprintf(" %s", inst.Flag)
+		} else if instOp == "RST" {
+			s += fmt.Sprintf(" %02X", inst.Abs)
+		}
+
+		if inst.Prefixed {
+			s += fmt.Sprintf(" %d", inst.Bit)
+		}
+
+		if inst.To != "" {
+			s += fmt.Sprintf(" %s", t)
+		}
+		if inst.From != "" && !inst.Prefixed {
+			s += fmt.Sprintf(" %s", f)
+		}
+	case N8, A8:
+		// 1 arg
+		if t != "" && t != m8 {
+			s += fmt.Sprintf(" %s", t)
+		}
+		s += fmt.Sprintf(" %02X", b.Read(instAddr+1))
+		if f != "" && f != m8 {
+			s += fmt.Sprintf(" %s", f)
+		}
+	case N16, A16:
+		// 2 args
+
+		if (instOp == "JP" || instOp == "CALL") && inst.Flag != NOFLAG {
+			s += fmt.Sprintf(" %s", inst.Flag)
+		}
+
+		if inst.To != "" {
+			s += fmt.Sprintf(" %s", t)
+		}
+
+		addr := utils.JoinBytes(b.Read(instAddr+2), b.Read(instAddr+1))
+		s += fmt.Sprintf(" %04X", addr)
+	case E8:
+		// 1 arg, with signed equivalent in parentheses (TODO)
+
+		if (instOp == "JR") && inst.Flag != NOFLAG {
+			s += fmt.Sprintf(" %s", inst.Flag)
+		}
+		n8 := b.Read(instAddr + 1)
+		s += fmt.Sprintf(" %02X", n8)
+		e8 := int8(n8)
+		s += fmt.Sprintf(" (%d)", e8)
+	default:
+		log.Fatalf("unhandled datatype %s", dt)
+	}
+
+	return s
+}
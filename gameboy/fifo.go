@@ -1,4 +1,4 @@
-package main
+package gameboy
 
 type Pixel struct {
 	c          byte // 0-3
@@ -27,15 +27,20 @@ func (f FIFO) CanPushBG() bool {
 }
 
 // Push new pixels to the object FIFO.
-// If new pixels are pushed to a non-empty FIFO, every pixel up to Len() in the FIFO is kept.
-// Only the pixels after, and including, Len() are added from the new pixels.
-// e.g. If there are 5 pixels in the FIFO, but the last 2 are transparent, and a new 8 pixels are pushed, then only the last 5 of the new pixels are added to the FIFO.
+// Pixels already in the FIFO belong to objects with higher priority, so they are only
+// replaced where they are transparent. New pixels past the end of the FIFO are added.
+// e.g. If there are 5 pixels in the FIFO, but the 2nd is transparent, and a new 8 pixels are pushed,
+// then the 2nd new pixel replaces it and the last 3 new pixels are added to the FIFO.
 func (f *FIFO) PushObject(data []Pixel) {
-	l := f.Len()
-
-	data = data[l:]
-	*f = (*f)[:l]
-	*f = append(*f, data...)
+	for i, pix := range data {
+		if i >= len(*f) {
+			*f = append(*f, data[i:]...)
+			return
+		}
+		if (*f)[i].c == 0 {
+			(*f)[i] = pix
+		}
+	}
 }
 
 func (f *FIFO) Push(data []Pixel) {
@@ -58,17 +63,3 @@ func (f *FIFO) Pop() Pixel {
 func (f *FIFO) Clear() {
 	*f = *NewFIFO()
 }
-
-// Returns the number of pixels up to and including the last non-transparent pixel.
-// Object FIFO only.
-func (f *FIFO) Len() int {
-	length := len(*f)
-	for i := len(*f) - 1; i >= 0; i-- {
-		if (*f)[i].c == 0 {
-			length--
-		} else {
-			break
-		}
-	}
-	return length
-}
@@ -0,0 +1,197 @@
+package gameboy
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Cartridge header, 0x0100-0x014F.
+type CartHeader struct {
+	Title          string
+	CGBFlag        byte // 0x80 = CGB enhanced, 0xC0 = CGB only
+	SGBFlag        byte // 0x03 = SGB functions supported
+	CartType       byte
+	ROMSize        byte
+	RAMSize        byte
+	OldLicensee    byte
+	NewLicensee    string // only used if OldLicensee == 0x33
+	Version        byte
+	HeaderChecksum byte
+	GlobalChecksum uint16
+
+	headerChecksumOK bool
+	globalChecksumOK bool
+}
+
+type mapper string
+
+const (
+	MAPPER_NONE    mapper = "ROM ONLY"
+	MAPPER_MBC1    mapper = "MBC1"
+	MAPPER_MBC2    mapper = "MBC2"
+	MAPPER_MBC3    mapper = "MBC3"
+	MAPPER_MBC5    mapper = "MBC5"
+	MAPPER_MBC6    mapper = "MBC6"
+	MAPPER_MBC7    mapper = "MBC7"
+	MAPPER_MMM01   mapper = "MMM01"
+	MAPPER_CAMERA  mapper = "POCKET CAMERA"
+	MAPPER_TAMA5   mapper = "BANDAI TAMA5"
+	MAPPER_HUC1    mapper = "HuC1"
+	MAPPER_HUC3    mapper = "HuC3"
+	MAPPER_UNKNOWN mapper = "UNKNOWN"
+)
+
+// Hardware found on the cartridge, decoded from the cartridge type byte at 0x0147.
+type cartType struct {
+	mapper  mapper
+	ram     bool
+	battery bool
+	timer   bool
+	rumble  bool
+}
+
+var cartTypes = map[byte]cartType{
+	0x00: {mapper: MAPPER_NONE},
+	0x01: {mapper: MAPPER_MBC1},
+	0x02: {mapper: MAPPER_MBC1, ram: true},
+	0x03: {mapper: MAPPER_MBC1, ram: true, battery: true},
+	0x05: {mapper: MAPPER_MBC2},
+	0x06: {mapper: MAPPER_MBC2, battery: true},
+	0x08: {mapper: MAPPER_NONE, ram: true},
+	0x09: {mapper: MAPPER_NONE, ram: true, battery: true},
+	0x0B: {mapper: MAPPER_MMM01},
+	0x0C: {mapper: MAPPER_MMM01, ram: true},
+	0x0D: {mapper: MAPPER_MMM01, ram: true, battery: true},
+	0x0F: {mapper: MAPPER_MBC3, timer: true, battery: true},
+	0x10: {mapper: MAPPER_MBC3, timer: true, ram: true, battery: true},
+	0x11: {mapper: MAPPER_MBC3},
+	0x12: {mapper: MAPPER_MBC3, ram: true},
+	0x13: {mapper: MAPPER_MBC3, ram: true, battery: true},
+	0x19: {mapper: MAPPER_MBC5},
+	0x1A: {mapper: MAPPER_MBC5, ram: true},
+	0x1B: {mapper: MAPPER_MBC5, ram: true, battery: true},
+	0x1C: {mapper: MAPPER_MBC5, rumble: true},
+	0x1D: {mapper: MAPPER_MBC5, rumble: true, ram: true},
+	0x1E: {mapper: MAPPER_MBC5, rumble: true, ram: true, battery: true},
+	0x20: {mapper: MAPPER_MBC6},
+	0x22: {mapper: MAPPER_MBC7, rumble: true, ram: true, battery: true},
+	0xFC: {mapper: MAPPER_CAMERA},
+	0xFD: {mapper: MAPPER_TAMA5},
+	0xFE: {mapper: MAPPER_HUC3},
+	0xFF: {mapper: MAPPER_HUC1, ram: true, battery: true},
+}
+
+// RAM size byte (0x0149 in the cartridge header) to amount of external RAM in bytes.
+var ramSizes = map[byte]int{
+	0x00: 0,
+	0x01: 0x800, // unofficial 2 KiB, only found in homebrew
+	0x02: 0x2000,
+	0x03: 0x8000,  // 4 banks of 8 KiB
+	0x04: 0x20000, // 16 banks of 8 KiB
+	0x05: 0x10000, // 8 banks of 8 KiB
+}
+
+func ParseHeader(rom []byte) (*CartHeader, error) {
+	if len(rom) < 0x150 {
+		return nil, fmt.Errorf("rom is too small to contain a header, got %d bytes", len(rom))
+	}
+
+	h := &CartHeader{
+		CGBFlag:        rom[0x143],
+		SGBFlag:        rom[0x146],
+		CartType:       rom[0x147],
+		ROMSize:        rom[0x148],
+		RAMSize:        rom[0x149],
+		OldLicensee:    rom[0x14B],
+		NewLicensee:    string(rom[0x144:0x146]),
+		Version:        rom[0x14C],
+		HeaderChecksum: rom[0x14D],
+		GlobalChecksum: utils.JoinBytes(rom[0x14E], rom[0x14F]),
+	}
+
+	// Newer carts use the last bytes of the title for the manufacturer code and CGB flag
+	titleEnd := 0x144
+	if utils.IsBitSet(7, h.CGBFlag) {
+		titleEnd = 0x143
+	}
+	title := string(rom[0x134:titleEnd])
+	if i := strings.IndexByte(title, 0); i >= 0 {
+		title = title[:i]
+	}
+	h.Title = strings.TrimSpace(title)
+
+	var headerSum byte
+	for addr := 0x134; addr <= 0x14C; addr++ {
+		headerSum = headerSum - rom[addr] - 1
+	}
+	h.headerChecksumOK = headerSum == h.HeaderChecksum
+
+	var globalSum uint16
+	for addr, b := range rom {
+		if addr != 0x14E && addr != 0x14F {
+			globalSum += uint16(b)
+		}
+	}
+	h.globalChecksumOK = globalSum == h.GlobalChecksum
+
+	return h, nil
+}
+
+func (h *CartHeader) Mapper() mapper {
+	if t, ok := cartTypes[h.CartType]; ok {
+		return t.mapper
+	}
+	return MAPPER_UNKNOWN
+}
+
+func (h *CartHeader) HasRAM() bool {
+	return cartTypes[h.CartType].ram
+}
+
+func (h *CartHeader) HasBattery() bool {
+	return cartTypes[h.CartType].battery
+}
+
+func (h *CartHeader) HasTimer() bool {
+	return cartTypes[h.CartType].timer
+}
+
+func (h *CartHeader) HasRumble() bool {
+	return cartTypes[h.CartType].rumble
+}
+
+// Number of 16 KiB ROM banks, as declared by the header.
+func (h *CartHeader) ROMBanks() int {
+	if h.ROMSize > 0x08 {
+		return 0
+	}
+	return 2 << h.ROMSize
+}
+
+// Amount of external RAM in bytes, as declared by the header.
+func (h *CartHeader) RAMBytes() int {
+	return ramSizes[h.RAMSize]
+}
+
+func (h *CartHeader) Licensee() string {
+	if h.OldLicensee == 0x33 {
+		return h.NewLicensee
+	}
+	return fmt.Sprintf("%02X", h.OldLicensee)
+}
+
+// The boot rom refuses to run a cart with a bad header checksum.
+func (h *CartHeader) HeaderChecksumOK() bool {
+	return h.headerChecksumOK
+}
+
+// Not verified by real hardware.
+func (h *CartHeader) GlobalChecksumOK() bool {
+	return h.globalChecksumOK
+}
+
+func (h *CartHeader) String() string {
+	return fmt.Sprintf("%q, type 0x%02X (%s), %d ROM banks, %d bytes RAM, licensee %s, version %d", h.Title, h.CartType, h.Mapper(), h.ROMBanks(), h.RAMBytes(), h.Licensee(), h.Version)
+}
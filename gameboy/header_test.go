@@ -0,0 +1,174 @@
+package gameboy
+
+import (
+	"testing"
+)
+
+// Build a rom with a valid header for the given cart type, ROM size byte and RAM size byte.
+func newTestHeaderRom(cartType, romSize, ramSize byte) []byte {
+	rom := make([]byte, 0x8000<<romSize)
+	copy(rom[0x134:], "TESTROM")
+	rom[0x147] = cartType
+	rom[0x148] = romSize
+	rom[0x149] = ramSize
+	rom[0x14B] = 0x01
+	rom[0x14C] = 0x02
+
+	var headerSum byte
+	for addr := 0x134; addr <= 0x14C; addr++ {
+		headerSum = headerSum - rom[addr] - 1
+	}
+	rom[0x14D] = headerSum
+
+	var globalSum uint16
+	for _, b := range rom {
+		globalSum += uint16(b)
+	}
+	rom[0x14E] = byte(globalSum >> 8)
+	rom[0x14F] = byte(globalSum)
+
+	return rom
+}
+
+func TestParseHeader(t *testing.T) {
+	rom := newTestHeaderRom(0x03, 0x02, 0x03)
+
+	h, err := ParseHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Title != "TESTROM" {
+		t.Errorf("title: want %q, got %q", "TESTROM", h.Title)
+	}
+	if h.Mapper() != MAPPER_MBC1 {
+		t.Errorf("mapper: want %s, got %s", MAPPER_MBC1, h.Mapper())
+	}
+	if !h.HasRAM() || !h.HasBattery() || h.HasTimer() || h.HasRumble() {
+		t.Errorf("wrong hardware flags for cart type 0x%02X", h.CartType)
+	}
+	if h.ROMBanks() != 8 {
+		t.Errorf("ROM banks: want %d, got %d", 8, h.ROMBanks())
+	}
+	if h.RAMBytes() != 0x8000 {
+		t.Errorf("RAM bytes: want 0x%X, got 0x%X", 0x8000, h.RAMBytes())
+	}
+	if h.Licensee() != "01" || h.Version != 0x02 {
+		t.Errorf("licensee/version: got %s/%d", h.Licensee(), h.Version)
+	}
+	if !h.HeaderChecksumOK() {
+		t.Errorf("header checksum should be valid")
+	}
+	if !h.GlobalChecksumOK() {
+		t.Errorf("global checksum should be valid")
+	}
+
+	rom[0x134] = 'X'
+	h, _ = ParseHeader(rom)
+	if h.HeaderChecksumOK() {
+		t.Errorf("header checksum should be invalid after modifying the title")
+	}
+}
+
+func TestParseHeaderTooSmall(t *testing.T) {
+	if _, err := ParseHeader(make([]byte, 0x100)); err == nil {
+		t.Errorf("expected error for rom without a header")
+	}
+}
+
+func TestNewCartridge(t *testing.T) {
+	testCases := []struct {
+		cartType byte
+		want     mapper
+		wantErr  bool
+	}{
+		{cartType: 0x00, want: MAPPER_NONE},
+		{cartType: 0x09, want: MAPPER_NONE},
+		{cartType: 0x01, want: MAPPER_MBC1},
+		{cartType: 0x03, want: MAPPER_MBC1},
+		{cartType: 0x06, want: MAPPER_MBC2},
+		{cartType: 0x10, want: MAPPER_MBC3},
+		{cartType: 0x13, want: MAPPER_MBC3},
+		{cartType: 0x19, want: MAPPER_MBC5},
+		{cartType: 0x1E, want: MAPPER_MBC5},
+		{cartType: 0x22, wantErr: true},
+		{cartType: 0xFC, wantErr: true},
+		{cartType: 0x04, wantErr: true}, // not a valid type
+	}
+
+	for _, tt := range testCases {
+		c, err := NewCartridge(newTestHeaderRom(tt.cartType, 0x00, 0x02))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("cart type 0x%02X: expected error", tt.cartType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cart type 0x%02X: unexpected error %v", tt.cartType, err)
+			continue
+		}
+		if c.Header().Mapper() != tt.want {
+			t.Errorf("cart type 0x%02X: want %s, got %s", tt.cartType, tt.want, c.Header().Mapper())
+		}
+	}
+}
+
+func TestNewCartridgeTruncatedROM(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cartType byte
+		romSize  byte
+	}{
+		{"ROM ONLY", 0x00, 0x00},
+		{"MBC1", 0x01, 0x02},
+		{"MBC2", 0x05, 0x02},
+		{"MBC3", 0x11, 0x02},
+		{"MBC5", 0x19, 0x02},
+	}
+
+	for _, tt := range testCases {
+		rom := newTestHeaderRom(tt.cartType, tt.romSize, 0x00)
+		rom = rom[:0x5123] // not even a whole number of banks
+		rom[0x5000] = 0x42
+
+		c, err := NewCartridge(rom)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.romSize > 0 {
+			c.Write(0x2100, 0x07) // last bank, MBC2 needs A8 set
+		} else {
+			if got := c.Read(0x5000); got != 0x42 {
+				t.Errorf("%s: byte in the file: got 0x%02X, want 0x42", tt.name, got)
+			}
+		}
+		for _, addr := range []uint16{0x5123, 0x7FFF} {
+			if got := c.Read(addr); got != 0xFF {
+				t.Errorf("%s: read 0x%04X past the end of the file: got 0x%02X, want 0xFF", tt.name, addr, got)
+			}
+		}
+	}
+}
+
+// 4 and 8 MiB headers declare 256 and 512 banks, too many for a byte
+func TestNewCartridgeMBC1ManyBanks(t *testing.T) {
+	for _, romSize := range []byte{0x07, 0x08} {
+		rom := newTestHeaderRom(0x01, 0x00, 0x00)
+		rom[0x148] = romSize
+		rom[0x4000] = 0x42
+
+		c, err := NewCartridge(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Read(0x4000); got != 0x42 {
+			t.Errorf("ROM size 0x%02X, bank 1: got 0x%02X, want 0x42", romSize, got)
+		}
+		c.Write(0x2000, 0x1F)
+		c.Write(0x4000, 0x03) // bank 0x7F
+		if got := c.Read(0x4000); got != 0xFF {
+			t.Errorf("ROM size 0x%02X, bank 0x7F: got 0x%02X, want 0xFF", romSize, got)
+		}
+	}
+}
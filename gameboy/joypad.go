@@ -1,19 +1,22 @@
-package main
+package gameboy
 
 import (
 	utils "github.com/mikzorz/goboy-emu/helpers"
 )
 
 type Joypad struct {
+	bus        *Bus
 	JOYP       byte
 	Directions byte
 	Buttons    byte
+	lines      byte // P10-P13 as last seen, a high to low transition requests JOYPAD_INTR
 }
 
 func NewJoypad() *Joypad {
 	return &Joypad{
 		Directions: 0xFF,
 		Buttons:    0xFF,
+		lines:      0xF,
 	}
 }
 
@@ -49,6 +52,7 @@ func (j *Joypad) Press(b Button) {
 	case JoyDown:
 		j.Directions = utils.ResetBit(3, j.Directions)
 	}
+	j.update()
 }
 
 func (j *Joypad) Release(b Button) {
@@ -70,21 +74,37 @@ func (j *Joypad) Release(b Button) {
 	case JoyDown:
 		j.Directions = utils.SetBit(3, j.Directions)
 	}
+	j.update()
 }
 
-func (j *Joypad) Read() byte {
-	var ret byte = j.JOYP
+// P10-P13. A pressed button pulls its line low if its group is selected.
+// With both groups selected, a line is low if either button on it is pressed.
+func (j *Joypad) output() byte {
+	var lines byte = 0xF
 	if !utils.IsBitSet(4, j.JOYP) {
-		// Directions
-		ret = (ret & 0xF0) | (j.Directions & 0xF)
-	} else if !utils.IsBitSet(5, j.JOYP) {
-		// Buttons
-		ret = (ret & 0xF0) | (j.Buttons & 0xF)
+		lines &= j.Directions
+	}
+	if !utils.IsBitSet(5, j.JOYP) {
+		lines &= j.Buttons
+	}
+	return lines & 0xF
+}
+
+// Any line going from high to low requests the joypad interrupt and ends STOP.
+func (j *Joypad) update() {
+	lines := j.output()
+	if j.lines&^lines != 0 && j.bus != nil {
+		j.bus.InterruptRequest(JOYPAD_INTR)
+		j.bus.stopped = false
 	}
-	return ret | 0xC0 // bits 6 and 7 always return 1
+	j.lines = lines
+}
+
+func (j *Joypad) Read() byte {
+	return 0xC0 | (j.JOYP & 0x30) | j.output() // bits 6 and 7 always return 1
 }
 
 func (j *Joypad) Write(data byte) {
-	keySelect := data & 0x30
-	j.JOYP = keySelect | (j.JOYP & 0xF) // TODO preserving bottom nibble might not do anything
+	j.JOYP = data & 0x30
+	j.update() // selecting a group with a button held also counts
 }
@@ -0,0 +1,135 @@
+package gameboy
+
+import (
+	"testing"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+func TestJoypadRead(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sel     byte
+		pressed []Button
+		want    byte
+	}{
+		{"none selected", 0x30, []Button{JoyA, JoyRight}, 0xFF},
+		{"directions", 0x20, []Button{JoyA, JoyRight}, 0xEE},
+		{"buttons", 0x10, []Button{JoyA, JoyRight, JoyStart}, 0xD6},
+		{"both", 0x00, []Button{JoyB, JoyDown}, 0xC5},
+		{"both, same line", 0x00, []Button{JoyA, JoyRight}, 0xCE},
+	}
+
+	for _, tt := range testCases {
+		j := NewJoypad()
+		j.Write(tt.sel)
+		for _, b := range tt.pressed {
+			j.Press(b)
+		}
+		if got := j.Read(); got != tt.want {
+			t.Errorf("%s: want 0x%02X, got 0x%02X", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestJoypadInterrupt(t *testing.T) {
+	joypadIF := func(b *Bus) bool { return b.cpu.IF&(1<<JOYPAD_INTR) != 0 }
+
+	b := newTestMachine(t, nil).bus
+	b.cpu.IF = 0
+	b.joypad.Write(0x20) // directions
+	b.joypad.Press(JoyA)
+	if joypadIF(b) {
+		t.Errorf("pressing an unselected button should not request an interrupt")
+	}
+
+	b.joypad.Press(JoyUp)
+	if !joypadIF(b) {
+		t.Errorf("pressing a selected button should request an interrupt")
+	}
+
+	b.cpu.IF = 0
+	b.joypad.Release(JoyUp)
+	if joypadIF(b) {
+		t.Errorf("releasing should not request an interrupt")
+	}
+
+	b.joypad.Write(0x10) // buttons, A is still held
+	if !joypadIF(b) {
+		t.Errorf("selecting a group with a button held should request an interrupt")
+	}
+
+	b.cpu.IF = 0
+	b.joypad.Write(0x00)
+	b.joypad.Press(JoyRight) // same line as A, already low
+	if joypadIF(b) {
+		t.Errorf("a line that is already low should not request an interrupt")
+	}
+}
+
+func newJoypadTestMachine(t *testing.T, program []byte) *Machine {
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x60:], []byte{
+		0x0E, 0x01, // LD C, 1
+		0xD9, // RETI
+	})
+	copy(rom[0x100:], program)
+	m, err := New(rom, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestJoypadWakesHalt(t *testing.T) {
+	m := newJoypadTestMachine(t, []byte{
+		0x0E, 0x00, // LD C, 0
+		0x3E, 0x10, // LD A, 0x10
+		0xE0, 0xFF, // LDH (IE), A
+		0xE0, 0x00, // LDH (JOYP), A ; buttons
+		0xAF,       // XOR A
+		0xE0, 0x0F, // LDH (IF), A
+		0xFB,       // EI
+		0x76,       // HALT
+		0x04,       // INC B
+		0x18, 0xFE, // JR -2
+	})
+
+	// VBlank and timer flags are set while halted, but only the joypad is enabled
+	m.RunFrame()
+	m.RunFrame()
+	if r := m.Registers(); utils.LSB(r.BC) != 0 || r.PC != 0x10D {
+		t.Fatalf("should still be halted, got C %d PC 0x%04X", utils.LSB(r.BC), r.PC)
+	}
+
+	m.SetButton(JoyStart, true)
+	m.RunFrame()
+	if r := m.Registers(); utils.LSB(r.BC) != 1 || utils.MSB(r.BC) == 0 {
+		t.Errorf("joypad interrupt should wake the CPU and run the handler, got C %d B %d", utils.LSB(r.BC), utils.MSB(r.BC))
+	}
+}
+
+func TestJoypadEndsStop(t *testing.T) {
+	m := newJoypadTestMachine(t, []byte{
+		0x3E, 0x20, // LD A, 0x20
+		0xE0, 0x00, // LDH (JOYP), A ; directions
+		0x10, 0x00, // STOP
+		0x04,       // INC B
+		0x18, 0xFD, // JR -3
+	})
+
+	m.RunFrame()
+	m.RunFrame()
+	if r := m.Registers(); utils.MSB(r.BC) != 0 {
+		t.Fatalf("should be stopped, got B %d", utils.MSB(r.BC))
+	}
+	if div := m.Timers().DIV; div != 0 {
+		t.Errorf("DIV should be held at 0 while stopped, got 0x%04X", div)
+	}
+
+	m.SetButton(JoyLeft, true)
+	m.RunFrame()
+	if r := m.Registers(); utils.MSB(r.BC) == 0 {
+		t.Errorf("a button press should end STOP")
+	}
+}
@@ -0,0 +1,150 @@
+package gameboy
+
+import (
+	// "log"
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+const SCREEN_WIDTH = 160
+const SCREEN_HEIGHT = 144
+
+type LCDI interface {
+	Cycle()
+	SetBus(b *Bus)
+	SetBgFIFO(f *FIFO)
+	SetObjFIFO(f *FIFO)
+	GetX() byte
+	SetX(byte)
+	Width() int
+	SetPixelsToDiscard(byte)
+}
+
+type LCD struct {
+	bus             *Bus
+	bgFIFO          *FIFO
+	objFIFO         *FIFO
+	x, y            byte
+	pixelsToDiscard byte
+	width           int // SCREEN_WIDTH, unless wider is wanted for debugging
+
+	// Shades 0-3 (white to black), width*SCREEN_HEIGHT from top-left.
+	// Pixels are drawn to back, which becomes front at VBlank, so a finished frame is never torn.
+	front, back []byte
+	skipFrame   bool // the first frame after the LCD is turned on is not shown
+}
+
+func NewLCD(width int) *LCD {
+	return &LCD{
+		width: width,
+		front: make([]byte, width*SCREEN_HEIGHT),
+		back:  make([]byte, width*SCREEN_HEIGHT),
+	}
+}
+
+func (l *LCD) Cycle() {
+	if utils.IsBitSet(7, l.bus.ppu.LCDC) {
+
+		// TODO: don't check if ppu mode == DRAWING, when final pixels are pushed to FIFO, ppu should be able to switch to HBLANK while the LCD keeps drawing
+		if l.bus.ppu.mode == MODE_DRAWING && int(l.x) < l.width && l.bgFIFO.CanPop() && !l.bus.ppu.fetchingObject {
+			// Always pop a bg pixel, only pop obj pixel if one exists
+			bgPix := l.bgFIFO.Pop()
+			objPix := Pixel{}
+			if l.objFIFO.CanPop() {
+				objPix = l.objFIFO.Pop()
+			}
+
+			if l.pixelsToDiscard > 0 {
+				l.pixelsToDiscard--
+			} else {
+				l.back[int(l.bus.ppu.LY)*l.width+int(l.x)] = l.GetPixelColour(bgPix, objPix)
+
+				l.x++
+			}
+		}
+	}
+}
+
+// Returns the shade of the pixel after palette mapping, 0-3.
+func (l *LCD) GetPixelColour(bgPix, objPix Pixel) byte {
+	// LCDC and the palettes are read as each pixel is shifted out, so writes during mode 3 show from the next pixel.
+	// Read directly rather than through the bus, which OAM DMA would block.
+	ppu := l.bus.ppu
+	pix := Pixel{}
+	var pal byte
+
+	bgWinEnabled := utils.IsBitSet(0, ppu.LCDC)
+	objEnabled := utils.IsBitSet(1, ppu.LCDC)
+
+	if !objEnabled {
+		objPix.c = 0
+	}
+
+	if !bgWinEnabled {
+		// if bg/window is disabled and object is either transparent or disabled, draw a white pixel
+		if objPix.c == 0 {
+			return 0
+		}
+		bgPix.c = 0
+	}
+
+	if (objPix.bgPriority == 1 && bgPix.c != 0) || objPix.c == 0 {
+		pix.c = bgPix.c
+		pal = ppu.BGP
+	} else {
+		pix.c = objPix.c
+		pal = ppu.OBP0
+		if objPix.pal == 1 {
+			pal = ppu.OBP1
+		}
+	}
+
+	paletteIdx := (pix.c * 2)
+	return (pal >> paletteIdx) & 0x3
+}
+
+// Called at VBlank, shows the frame that was just drawn.
+func (l *LCD) swapBuffers() {
+	if l.skipFrame {
+		l.skipFrame = false
+		return
+	}
+	l.front, l.back = l.back, l.front
+}
+
+// Called when the LCD is turned off, the screen stays white until a frame is shown.
+func (l *LCD) blank() {
+	clear(l.front)
+	clear(l.back)
+}
+
+func (l *LCD) Framebuffer() []byte {
+	return l.front
+}
+
+func (l *LCD) SetBus(b *Bus) {
+	l.bus = b
+}
+
+func (l *LCD) SetBgFIFO(f *FIFO) {
+	l.bgFIFO = f
+}
+
+func (l *LCD) SetObjFIFO(f *FIFO) {
+	l.objFIFO = f
+}
+
+func (l *LCD) GetX() byte {
+	return l.x
+}
+
+func (l *LCD) SetX(val byte) {
+	l.x = val
+}
+
+func (l *LCD) Width() int {
+	return l.width
+}
+
+func (l *LCD) SetPixelsToDiscard(amount byte) {
+	l.pixelsToDiscard = amount
+}
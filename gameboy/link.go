@@ -0,0 +1,119 @@
+package gameboy
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+)
+
+// Link cable between two machines over a stream, e.g. a TCP or Unix socket.
+// Both sides stop every LINK_SYNC_CYCLES and swap their serial state, so neither
+// can run ahead of the other. A transfer started with the internal clock takes the
+// other side's SB from the last sync, and the other side completes its transfer at the next one.
+
+const LINK_SYNC_CYCLES = 1024 // two serial bits at 8192 Hz
+
+const (
+	linkWaiting   = 1 << iota // SC has a transfer waiting on the external clock
+	linkDelivered             // completed a transfer with the internal clock, using the other side's SB
+)
+
+// Sent by each side at every sync.
+type linkMessage struct {
+	flags byte
+	SB    byte // current SB, shifted out if the other side starts a transfer
+	sent  byte // with linkDelivered, the byte shifted out to the other side
+}
+
+type Link struct {
+	m      *Machine
+	conn   io.ReadWriter
+	remote linkMessage // as of the last sync
+	sent   byte
+	sentOK bool
+}
+
+// Connect m to another machine over conn. The other machine must also call Connect.
+func Connect(m *Machine, conn io.ReadWriter) *Link {
+	l := &Link{m: m, conn: conn}
+	m.link = l
+	m.SetSerialPeer(l)
+	return l
+}
+
+// Dial or listen for one connection on addr, "tcp:host:port" or "unix:path".
+// A bare "host:port" is TCP.
+func DialLink(addr string, listen bool) (net.Conn, error) {
+	network := "tcp"
+	if n, a, ok := strings.Cut(addr, ":"); ok && (n == "tcp" || n == "unix") {
+		network, addr = n, a
+	}
+
+	if !listen {
+		return net.Dial(network, addr)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	return ln.Accept()
+}
+
+// SerialPeer, called when this side's internal clock transfer completes.
+func (l *Link) Exchange(out byte) (in byte) {
+	if l.remote.flags&linkWaiting == 0 {
+		return 0xFF
+	}
+	l.remote.flags &^= linkWaiting // one transfer per sync
+	l.sent, l.sentOK = out, true
+	return l.remote.SB
+}
+
+func (l *Link) sync() error {
+	s := l.m.bus.serial
+	msg := linkMessage{SB: s.SB, sent: l.sent}
+	if s.transferring() && !s.internalClock() {
+		msg.flags |= linkWaiting
+	}
+	if l.sentOK {
+		msg.flags |= linkDelivered
+	}
+	l.sentOK = false
+
+	if _, err := l.conn.Write([]byte{msg.flags, msg.SB, msg.sent}); err != nil {
+		return err
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(l.conn, buf); err != nil {
+		return err
+	}
+	l.remote = linkMessage{flags: buf[0], SB: buf[1], sent: buf[2]}
+
+	if l.remote.flags&linkDelivered != 0 {
+		s.receive(l.remote.sent)
+	}
+	return nil
+}
+
+// Called by Machine.Tick
+func (l *Link) tick() {
+	if l.m.cycles%LINK_SYNC_CYCLES != 0 {
+		return
+	}
+	if err := l.sync(); err != nil {
+		log.Printf("link cable disconnected: %v", err)
+		l.Close()
+	}
+}
+
+// Unplug the cable. Closes the connection if it can be closed.
+func (l *Link) Close() error {
+	l.m.link = nil
+	l.m.SetSerialPeer(nil)
+	if c, ok := l.conn.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package gameboy
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Starts a transfer with SC, waits for it, then copies SB to B and stops at LD B,B
+func linkProgram(sb, sc byte) []byte {
+	return []byte{
+		0x3E, sb, // LD A, sb
+		0xE0, 0x01, // LDH (SB), A
+		0x3E, sc, // LD A, sc
+		0xE0, 0x02, // LDH (SC), A
+		0xF0, 0x02, // LDH A, (SC)
+		0x07,       // RLCA
+		0x38, 0xFB, // JR C, -5 ; until the transfer is done
+		0xF0, 0x01, // LDH A, (SB)
+		0x47,       // LD B, A
+		0x18, 0xFE, // JR -2
+	}
+}
+
+// Run both machines in lockstep over a real socket.
+func runLinked(t *testing.T, network, addr string, a, b *Machine, frames int) {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	connA, err := net.Dial(network, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connB := <-accepted
+	if connB == nil {
+		t.FailNow()
+	}
+	linkA, linkB := Connect(a, connA), Connect(b, connB)
+	defer linkA.Close()
+	defer linkB.Close()
+
+	done := make(chan bool)
+	run := func(m *Machine) {
+		for i := 0; i < frames*CYCLES_PER_FRAME; i++ {
+			m.Tick()
+		}
+		done <- true
+	}
+	go run(a)
+	go run(b)
+	<-done
+	<-done
+}
+
+func TestLinkExchange(t *testing.T) {
+	for _, tt := range []struct{ network, addr string }{
+		{"tcp", "127.0.0.1:0"},
+		{"unix", filepath.Join(t.TempDir(), "link.sock")},
+	} {
+		master := newTestMachine(t, linkProgram(0x12, 0x81))
+		slave := newTestMachine(t, linkProgram(0x34, 0x80))
+		runLinked(t, tt.network, tt.addr, master, slave, 2)
+
+		if got := utils.MSB(master.Registers().BC); got != 0x34 {
+			t.Errorf("%s: master should receive 0x34, got 0x%02X", tt.network, got)
+		}
+		if got := utils.MSB(slave.Registers().BC); got != 0x12 {
+			t.Errorf("%s: slave should receive 0x12, got 0x%02X", tt.network, got)
+		}
+		if master.Cycles() != slave.Cycles() {
+			t.Errorf("%s: machines should stay in lockstep, got %d and %d cycles", tt.network, master.Cycles(), slave.Cycles())
+		}
+	}
+}
+
+func TestLinkNobodyListening(t *testing.T) {
+	// Both sides use the internal clock, so neither is waiting for the other
+	a := newTestMachine(t, linkProgram(0x12, 0x81))
+	b := newTestMachine(t, linkProgram(0x34, 0x81))
+	runLinked(t, "tcp", "127.0.0.1:0", a, b, 1)
+
+	if got := utils.MSB(a.Registers().BC); got != 0xFF {
+		t.Errorf("want 0xFF, got 0x%02X", got)
+	}
+	if got := utils.MSB(b.Registers().BC); got != 0xFF {
+		t.Errorf("want 0xFF, got 0x%02X", got)
+	}
+}
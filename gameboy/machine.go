@@ -0,0 +1,151 @@
+package gameboy
+
+import (
+	"fmt"
+	"io"
+)
+
+// T-cycles in one frame, 154 scanlines of 456 dots
+const CYCLES_PER_FRAME = 70224
+
+const BOOT_ROM_SIZE = 0x100
+
+type Options struct {
+	SampleRate   int       // audio samples per second, 0 = no audio
+	ScreenWidth  int       // 0 = SCREEN_WIDTH, wider shows what is drawn past the right edge
+	AlwaysVBlank bool      // LY always reads 0x90, for Gameboy Doctor
+	DoctorLog    io.Writer // Gameboy Doctor CPU log, nil to disable
+	SerialLog    io.Writer // bytes sent over serial, nil to disable (blargg's test roms)
+	BootROM      []byte    // 256 byte DMG boot rom, nil to start from the state it leaves behind
+}
+
+// A complete DMG. Machines share no state, any number can run at once.
+type Machine struct {
+	bus    *Bus
+	cycles int   // T-cycles since power on
+	link   *Link // nil unless a link cable is connected
+}
+
+func New(rom []byte, opts Options) (*Machine, error) {
+	cart, err := NewCartridge(rom)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBus(cart)
+	if opts.BootROM != nil {
+		if len(opts.BootROM) != BOOT_ROM_SIZE {
+			return nil, fmt.Errorf("boot rom should be %d bytes, got %d", BOOT_ROM_SIZE, len(opts.BootROM))
+		}
+		b.coldBoot(opts.BootROM)
+	}
+	if opts.ScreenWidth > 0 && opts.ScreenWidth != SCREEN_WIDTH {
+		b.lcd = NewLCD(opts.ScreenWidth)
+		b.lcd.SetBus(b)
+		b.lcd.SetBgFIFO(b.ppu.bgFIFO)
+		b.lcd.SetObjFIFO(b.ppu.objFIFO)
+	}
+	b.apu.SetSampleRate(opts.SampleRate)
+	b.alwaysVblank = opts.AlwaysVBlank
+	b.cpu.doctorLog = opts.DoctorLog
+	b.serial.log = opts.SerialLog
+
+	return &Machine{bus: b}, nil
+}
+
+// Advance by one T-cycle.
+func (m *Machine) Tick() {
+	m.bus.Cycle()
+	m.cycles++
+	if m.link != nil {
+		m.link.tick()
+	}
+}
+
+// Advance by one M-cycle.
+func (m *Machine) MCycle() {
+	for i := 0; i < 4; i++ {
+		m.Tick()
+	}
+}
+
+// Run until the next instruction is fetched.
+// While halted, gives up after a frame's worth of cycles.
+func (m *Machine) StepInstruction() {
+	start := m.bus.cpu.fetches
+	for i := 0; i < CYCLES_PER_FRAME && m.bus.cpu.fetches == start; i++ {
+		m.Tick()
+	}
+}
+
+// Run until the PPU enters VBlank. With the LCD off, runs for one frame's worth of cycles.
+func (m *Machine) RunFrame() {
+	start := m.bus.ppu.frames
+	for i := 0; i < CYCLES_PER_FRAME && m.bus.ppu.frames == start; i++ {
+		m.Tick()
+	}
+}
+
+// T-cycles since power on.
+func (m *Machine) Cycles() int {
+	return m.cycles
+}
+
+// The last complete frame, as shades 0-3 (white to black) from top-left, row by row.
+// Width() pixels per row. Updated at each VBlank.
+func (m *Machine) Framebuffer() []byte {
+	return m.bus.lcd.Framebuffer()
+}
+
+func (m *Machine) Width() int {
+	return m.bus.lcd.Width()
+}
+
+func (m *Machine) SetButton(b Button, pressed bool) {
+	if pressed {
+		m.bus.joypad.Press(b)
+	} else {
+		m.bus.joypad.Release(b)
+	}
+}
+
+func (m *Machine) Cartridge() Cartridge {
+	return m.bus.cart
+}
+
+func (m *Machine) Header() *CartHeader {
+	return m.bus.cart.Header()
+}
+
+// The cartridge, if it has battery backed RAM.
+func (m *Machine) Battery() (BatteryCart, bool) {
+	return batteryCart(m.bus.cart)
+}
+
+func (m *Machine) SetSampleRate(rate int) {
+	m.bus.apu.SetSampleRate(rate)
+}
+
+// Interleaved stereo samples produced since the last call.
+func (m *Machine) AudioSamples() []int16 {
+	return m.bus.apu.Samples()
+}
+
+// Plug in the other end of the link cable, nil to unplug.
+func (m *Machine) SetSerialPeer(p SerialPeer) {
+	m.bus.serial.peer = p
+}
+
+// The peer has clocked a byte in with its internal clock.
+// Returns the byte shifted back, 0xFF if this side was not waiting on the external clock.
+func (m *Machine) SerialReceive(in byte) (out byte) {
+	return m.bus.serial.receive(in)
+}
+
+func (m *Machine) SaveState(w io.Writer) error {
+	return m.bus.SaveState(w)
+}
+
+func (m *Machine) LoadState(r io.Reader) error {
+	return m.bus.LoadState(r)
+}
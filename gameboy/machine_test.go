@@ -0,0 +1,214 @@
+package gameboy
+
+import (
+	"testing"
+)
+
+func newTestMachine(t *testing.T, program []byte) *Machine {
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x100:], program)
+	m, err := New(rom, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMachineStepInstruction(t *testing.T) {
+	m := newTestMachine(t, []byte{
+		0x00,             // NOP
+		0x21, 0x00, 0xC0, // LD HL, 0xC000
+		0x3C, // INC A
+	})
+
+	// First fetch is already done by the post-boot state
+	for _, want := range []uint16{0x101, 0x102, 0x105} {
+		m.StepInstruction()
+		if got := m.Registers().PC; got != want {
+			t.Errorf("want PC 0x%04X, got 0x%04X", want, got)
+		}
+	}
+}
+
+func TestMachinesAreIndependent(t *testing.T) {
+	loop := []byte{
+		0x3C,       // INC A
+		0x18, 0xFD, // JR -3
+	}
+	a := newTestMachine(t, loop)
+	b := newTestMachine(t, loop)
+
+	a.RunFrame()
+	a.RunFrame()
+	b.RunFrame()
+
+	if a.Registers().A == b.Registers().A {
+		t.Errorf("machines should not share state, both have A = 0x%02X", a.Registers().A)
+	}
+	if a.Cycles() <= b.Cycles() {
+		t.Errorf("machine that ran 2 frames should be ahead, got %d and %d cycles", a.Cycles(), b.Cycles())
+	}
+
+	a.SetButton(JoyStart, true)
+	a.bus.joypad.Write(0x10) // select buttons
+	b.bus.joypad.Write(0x10)
+	if a.Read(0xFF00)&0x8 != 0 || b.Read(0xFF00)&0x8 == 0 {
+		t.Errorf("start should only be pressed on the first machine")
+	}
+}
+
+func TestMachineRunFrame(t *testing.T) {
+	m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+	m.RunFrame()
+	m.RunFrame()
+	start := m.Cycles()
+	m.RunFrame()
+
+	if got := m.Cycles() - start; got != CYCLES_PER_FRAME {
+		t.Errorf("want %d cycles between VBlanks, got %d", CYCLES_PER_FRAME, got)
+	}
+	if got := m.PPU().LY; got != 144 {
+		t.Errorf("frame should end at the start of VBlank, got LY %d", got)
+	}
+	if len(m.Framebuffer()) != SCREEN_WIDTH*SCREEN_HEIGHT {
+		t.Errorf("want %d pixels, got %d", SCREEN_WIDTH*SCREEN_HEIGHT, len(m.Framebuffer()))
+	}
+}
+
+func TestFramebufferSwapsAtVBlank(t *testing.T) {
+	m := newTestMachine(t, []byte{
+		0x3E, 0xFF, // LD A, 0xFF
+		0xE0, 0x47, // LDH (BGP), A
+		0x18, 0xFE, // JR -2
+	})
+
+	// Blank tiles, so every pixel is shade BGP&3
+	m.RunFrame()
+	m.RunFrame()
+	for i, shade := range m.Framebuffer() {
+		if shade != 3 {
+			t.Fatalf("pixel %d,%d: want shade 3, got %d", i%SCREEN_WIDTH, i/SCREEN_WIDTH, shade)
+		}
+	}
+
+	// Changes mid-frame must not show until the frame is done
+	m.bus.ppu.BGP = 0x00
+	for m.PPU().LY != 72 {
+		m.Tick()
+	}
+	if got := m.Framebuffer()[0]; got != 3 {
+		t.Errorf("front buffer changed mid-frame, got shade %d", got)
+	}
+	m.RunFrame()
+	if got := m.Framebuffer()[0]; got != 0 {
+		t.Errorf("want shade 0 after VBlank, got %d", got)
+	}
+}
+
+func TestLCDOffAndOn(t *testing.T) {
+	m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+	m.bus.Write(0xFF47, 0xFF)                  // BGP, every pixel is shade 3
+	m.RunFrame()
+	m.RunFrame()
+
+	for m.PPU().LY != 72 {
+		m.Tick()
+	}
+	m.bus.Write(0xFF40, 0x11)
+	for i := 0; i < 1000; i++ {
+		m.Tick()
+	}
+	if got := m.Read(0xFF44); got != 0 {
+		t.Errorf("LY with LCD off: got %d, want 0", got)
+	}
+	if got := m.Read(0xFF41) & 0x3; got != 0 {
+		t.Errorf("STAT mode with LCD off: got %d, want 0", got)
+	}
+	if got := m.Read(0xFF40); got != 0x11 {
+		t.Errorf("LCDC: got 0x%02X, want 0x11", got)
+	}
+	checkShade := func(when string, want byte) {
+		for i, shade := range m.Framebuffer() {
+			if shade != want {
+				t.Fatalf("%s: pixel %d,%d: want shade %d, got %d", when, i%SCREEN_WIDTH, i/SCREEN_WIDTH, want, shade)
+			}
+		}
+	}
+	checkShade("LCD off", 0)
+
+	// The first line after turning on skips mode 2, STAT reads mode 0 until mode 3 and there is no mode 2 interrupt
+	m.bus.Write(0xFF41, 0x20)
+	m.bus.Write(0xFF0F, 0x00)
+	m.bus.Write(0xFF40, 0x91)
+	if m.PPU().LY != 0 {
+		t.Errorf("LY after turning on: got %d, want 0", m.PPU().LY)
+	}
+	for m.PPU().Dot < 88 {
+		m.Tick()
+		dot := m.PPU().Dot - 1 // the last dot run
+		want := byte(0)
+		if dot >= 80 {
+			want = 3
+		}
+		if got := m.Read(0xFF41) & 0x3; got != want {
+			t.Errorf("STAT mode at line 0 dot %d after turning on: got %d, want %d", dot, got, want)
+		}
+	}
+	if m.Read(0xFF0F)&0x02 != 0 {
+		t.Errorf("mode 2 STAT interrupt requested on the first line after turning on")
+	}
+	runToDot(m, 1, 4)
+	if got := m.Read(0xFF41) & 0x3; got != 2 {
+		t.Errorf("STAT mode at line 1 dot 4: got %d, want 2", got)
+	}
+	if m.Read(0xFF0F)&0x02 == 0 {
+		t.Errorf("no mode 2 STAT interrupt on line 1")
+	}
+	m.bus.Write(0xFF41, 0x00)
+
+	// The first frame after turning on stays white
+	m.RunFrame()
+	checkShade("first frame", 0)
+	m.RunFrame()
+	checkShade("second frame", 3)
+}
+
+func TestMachineBootROM(t *testing.T) {
+	boot := make([]byte, BOOT_ROM_SIZE)
+	copy(boot, []byte{0x31, 0xFE, 0xFF}) // LD SP, 0xFFFE
+	copy(boot[0xFC:], []byte{
+		0x3E, 0x01, // LD A, 1
+		0xE0, 0x50, // LDH (0x50), A ; unmap, falls through to 0x100
+	})
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x100:], []byte{0x18, 0xFE}) // JR -2
+
+	if _, err := New(rom, Options{BootROM: boot[:0xFF]}); err == nil {
+		t.Errorf("a boot rom of the wrong size should be an error")
+	}
+
+	m, err := New(rom, Options{BootROM: boot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := m.Registers(); r.PC != 0 || r.A != 0 || r.SP != 0 {
+		t.Errorf("should start with cold registers, got PC 0x%04X A 0x%02X SP 0x%04X", r.PC, r.A, r.SP)
+	}
+	if div := m.Timers().DIV; div != 0 {
+		t.Errorf("DIV should start at 0, got 0x%04X", div)
+	}
+	if got := m.Read(0x0000); got != 0x31 {
+		t.Errorf("boot rom should be mapped, got 0x%02X", got)
+	}
+	if got := m.Read(0x0100); got != 0x18 {
+		t.Errorf("cart should be visible above 0x00FF, got 0x%02X", got)
+	}
+
+	m.RunFrame()
+	if r := m.Registers(); r.PC < 0x100 || r.SP != 0xFFFE || r.A != 0x01 {
+		t.Errorf("should have run the boot rom into the cart, got PC 0x%04X SP 0x%04X A 0x%02X", r.PC, r.SP, r.A)
+	}
+	if got := m.Read(0x0000); got != rom[0] {
+		t.Errorf("boot rom should be unmapped after writing FF50, got 0x%02X", got)
+	}
+}
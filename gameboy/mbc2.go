@@ -0,0 +1,80 @@
+package gameboy
+
+import (
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// MBC2 cartridge, up to 256 KiB ROM and 512x4 bits of RAM built into the mapper.
+type MBC2 struct {
+	rom        []byte
+	ram        [0x200]byte // only the lower nibble of each byte is used
+	header     *CartHeader
+	romBank    int
+	ramEnabled bool
+	numOfBanks int
+	batteryRAM
+}
+
+func NewMBC2(rom []byte, header *CartHeader) *MBC2 {
+	return &MBC2{
+		rom:        rom,
+		header:     header,
+		romBank:    1,
+		numOfBanks: max((len(rom)+0x3FFF)/0x4000, 1),
+	}
+}
+
+func (c *MBC2) Read(addr uint16) byte {
+	switch {
+	case addr <= 0x3FFF:
+		return c.rom[addr]
+	case addr <= 0x7FFF:
+		bank := c.romBank % c.numOfBanks
+		return c.rom[bank*0x4000+int(addr-0x4000)]
+	default:
+		if !c.ramEnabled {
+			return 0xFF
+		}
+		// 512 bytes echoed across A000-BFFF, upper nibble is open bus
+		return c.ram[addr&0x1FF] | 0xF0
+	}
+}
+
+func (c *MBC2) Write(addr uint16, data byte) {
+	switch {
+	case addr <= 0x3FFF:
+		// Bit 8 of the address selects between the RAM enable and ROM bank registers
+		if utils.IsBitSet(0, utils.MSB(addr)) {
+			c.romBank = int(data & 0xF)
+			if c.romBank == 0 {
+				c.romBank = 1
+			}
+		} else {
+			c.ramEnabled = data&0xF == 0xA
+			if !c.ramEnabled {
+				c.ramDisabled()
+			}
+		}
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		if c.ramEnabled {
+			c.ram[addr&0x1FF] = data & 0xF
+			c.ramWritten()
+		}
+	}
+}
+
+func (c *MBC2) Header() *CartHeader {
+	return c.header
+}
+
+// Saved as 512 bytes, one nibble per byte.
+func (c *MBC2) SaveData() []byte {
+	c.saved()
+	return append([]byte{}, c.ram[:]...)
+}
+
+func (c *MBC2) LoadSaveData(data []byte) {
+	for i := 0; i < len(c.ram) && i < len(data); i++ {
+		c.ram[i] = data[i] & 0xF
+	}
+}
@@ -0,0 +1,64 @@
+package gameboy
+
+import (
+	"testing"
+)
+
+func newTestMBC2() *MBC2 {
+	rom := newTestHeaderRom(0x06, 0x03, 0x00) // 16 banks
+	for bank := 0; bank < len(rom)/0x4000; bank++ {
+		rom[bank*0x4000+0x200] = byte(bank)
+	}
+	header, _ := ParseHeader(rom)
+	return NewMBC2(rom, header)
+}
+
+func TestMBC2Registers(t *testing.T) {
+	c := newTestMBC2()
+
+	// Address bit 8 set, ROM bank
+	c.Write(0x2100, 0x05)
+	if got := c.Read(0x4200); got != 0x05 {
+		t.Errorf("want bank 5, got %d", got)
+	}
+	c.Write(0x0100, 0x00)
+	if got := c.Read(0x4200); got != 0x01 {
+		t.Errorf("bank 0 should map to bank 1, got %d", got)
+	}
+
+	// Address bit 8 clear, RAM enable. Must not change the ROM bank.
+	c.Write(0x2000, 0x0A)
+	if got := c.Read(0x4200); got != 0x01 {
+		t.Errorf("RAM enable write changed ROM bank to %d", got)
+	}
+	c.Write(0xA000, 0x03)
+	if got := c.Read(0xA000); got != 0xF3 {
+		t.Errorf("RAM should be enabled, want 0xF3, got 0x%02X", got)
+	}
+}
+
+func TestMBC2RAM(t *testing.T) {
+	c := newTestMBC2()
+
+	c.Write(0xA000, 0x0C)
+	if got := c.Read(0xA000); got != 0xFF {
+		t.Errorf("disabled RAM should read 0xFF, got 0x%02X", got)
+	}
+
+	c.Write(0x0000, 0x0A)
+	c.Write(0xA005, 0xAB)
+	if got := c.Read(0xA005); got != 0xFB {
+		t.Errorf("only lower nibble is stored, upper reads as 1, want 0xFB, got 0x%02X", got)
+	}
+
+	// Echoed every 512 bytes
+	for _, addr := range []uint16{0xA205, 0xB005, 0xBE05} {
+		if got := c.Read(addr); got != 0xFB {
+			t.Errorf("0x%04X should echo 0xA005, want 0xFB, got 0x%02X", addr, got)
+		}
+	}
+	c.Write(0xBFFF, 0x01)
+	if got := c.Read(0xA1FF); got != 0xF1 {
+		t.Errorf("write to 0xBFFF should land in 0xA1FF, got 0x%02X", got)
+	}
+}
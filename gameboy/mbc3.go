@@ -0,0 +1,116 @@
+package gameboy
+
+// MBC3 cartridge, up to 2 MiB ROM, 32 KiB RAM and an optional real time clock.
+type MBC3 struct {
+	rom        []byte
+	ram        []byte
+	header     *CartHeader
+	rtc        *RTC // nil if the cart has no timer
+	romBank    int
+	ramBank    byte // 0x00-0x03 selects a RAM bank, 0x08-0x0C selects an RTC register
+	ramEnabled bool // also enables access to the RTC registers
+	numOfBanks int
+	batteryRAM
+}
+
+func NewMBC3(rom []byte, header *CartHeader, clock TimeSource) *MBC3 {
+	c := &MBC3{
+		rom:        rom,
+		ram:        make([]byte, header.RAMBytes()),
+		header:     header,
+		romBank:    1,
+		numOfBanks: max((len(rom)+0x3FFF)/0x4000, 1),
+	}
+	if header.HasTimer() {
+		c.rtc = NewRTC(clock)
+	}
+	return c
+}
+
+func (c *MBC3) Read(addr uint16) byte {
+	switch {
+	case addr <= 0x3FFF:
+		return c.rom[addr]
+	case addr <= 0x7FFF:
+		bank := c.romBank % c.numOfBanks
+		return c.rom[bank*0x4000+int(addr-0x4000)]
+	default:
+		if !c.ramEnabled {
+			return 0xFF
+		}
+		if c.ramBank >= 0x08 && c.ramBank <= 0x0C {
+			if c.rtc == nil {
+				return 0xFF
+			}
+			return c.rtc.Read(int(c.ramBank - 0x08))
+		}
+		if len(c.ram) == 0 {
+			return 0xFF
+		}
+		return c.ram[c.getRAMAddress(addr)]
+	}
+}
+
+func (c *MBC3) Write(addr uint16, data byte) {
+	switch {
+	case addr <= 0x1FFF:
+		c.ramEnabled = data&0xF == 0xA
+		if !c.ramEnabled {
+			c.ramDisabled()
+		}
+	case addr <= 0x3FFF:
+		// 7 bit ROM bank, bank 0 maps to bank 1
+		c.romBank = int(data & 0x7F)
+		if c.romBank == 0 {
+			c.romBank = 1
+		}
+	case addr <= 0x5FFF:
+		c.ramBank = data
+	case addr <= 0x7FFF:
+		if c.rtc != nil {
+			c.rtc.WriteLatch(data)
+		}
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		if !c.ramEnabled {
+			return
+		}
+		if c.ramBank >= 0x08 && c.ramBank <= 0x0C {
+			if c.rtc != nil {
+				c.rtc.Write(int(c.ramBank-0x08), data)
+				c.ramWritten()
+			}
+			return
+		}
+		if len(c.ram) > 0 {
+			c.ram[c.getRAMAddress(addr)] = data
+			c.ramWritten()
+		}
+	}
+}
+
+func (c *MBC3) Header() *CartHeader {
+	return c.header
+}
+
+// Raw RAM, followed by the RTC footer if the cart has a timer.
+func (c *MBC3) SaveData() []byte {
+	c.saved()
+	data := append([]byte{}, c.ram...)
+	if c.rtc != nil {
+		data = append(data, c.rtc.Footer()...)
+	}
+	return data
+}
+
+func (c *MBC3) LoadSaveData(data []byte) {
+	copy(c.ram, data)
+	if c.rtc != nil && len(data) > len(c.ram) {
+		c.rtc.LoadFooter(data[len(c.ram):])
+	}
+}
+
+// Translate an address in A000-BFFF to an index of c.ram, for RAM banks 0-3.
+func (c *MBC3) getRAMAddress(addr uint16) int {
+	bank := int(c.ramBank & 0x3)
+	return (bank*0x2000 + int(addr-0xA000)) % len(c.ram)
+}
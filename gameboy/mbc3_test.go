@@ -0,0 +1,184 @@
+package gameboy
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeTime struct {
+	now time.Time
+}
+
+func (f *fakeTime) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeTime) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func newTestMBC3(cartType byte, clock TimeSource) *MBC3 {
+	rom := newTestHeaderRom(cartType, 0x06, 0x03) // 128 banks, 32 KiB RAM
+	for bank := 0; bank < len(rom)/0x4000; bank++ {
+		rom[bank*0x4000+0x200] = byte(bank)
+	}
+	header, _ := ParseHeader(rom)
+	return NewMBC3(rom, header, clock)
+}
+
+func TestMBC3ROMBanking(t *testing.T) {
+	c := newTestMBC3(0x13, &fakeTime{})
+
+	testCases := []struct {
+		write, want byte
+	}{
+		{write: 0x00, want: 0x01},
+		{write: 0x01, want: 0x01},
+		{write: 0x25, want: 0x25},
+		{write: 0x7F, want: 0x7F},
+		{write: 0xFF, want: 0x7F}, // only 7 bits
+	}
+
+	for _, tt := range testCases {
+		c.Write(0x2000, tt.write)
+		if got := c.Read(0x4200); got != tt.want {
+			t.Errorf("wrote 0x%02X, want bank 0x%02X, got 0x%02X", tt.write, tt.want, got)
+		}
+	}
+}
+
+func TestMBC3RAMBanking(t *testing.T) {
+	c := newTestMBC3(0x13, &fakeTime{})
+
+	c.Write(0xA000, 0x12)
+	if got := c.Read(0xA000); got != 0xFF {
+		t.Errorf("disabled RAM should read 0xFF, got 0x%02X", got)
+	}
+
+	c.Write(0x0000, 0x0A)
+	for bank := byte(0); bank < 4; bank++ {
+		c.Write(0x4000, bank)
+		c.Write(0xB000, 0x20+bank)
+	}
+	for bank := byte(0); bank < 4; bank++ {
+		c.Write(0x4000, bank)
+		if got := c.Read(0xB000); got != 0x20+bank {
+			t.Errorf("bank %d: want 0x%02X, got 0x%02X", bank, 0x20+bank, got)
+		}
+	}
+}
+
+func readRTC(c *MBC3, reg byte) byte {
+	c.Write(0x4000, 0x08+reg)
+	return c.Read(0xA000)
+}
+
+func writeRTC(c *MBC3, reg, data byte) {
+	c.Write(0x4000, 0x08+reg)
+	c.Write(0xA000, data)
+}
+
+func latchRTC(c *MBC3) {
+	c.Write(0x6000, 0x00)
+	c.Write(0x6000, 0x01)
+}
+
+func TestMBC3RTCLatch(t *testing.T) {
+	clock := &fakeTime{now: time.Unix(1000, 0)}
+	c := newTestMBC3(0x10, clock)
+	c.Write(0x0000, 0x0A)
+
+	clock.Advance(90 * time.Second)
+	if got := readRTC(c, RTC_S); got != 0 {
+		t.Errorf("seconds should not change before latching, got %d", got)
+	}
+
+	latchRTC(c)
+	if s, m := readRTC(c, RTC_S), readRTC(c, RTC_M); s != 30 || m != 1 {
+		t.Errorf("want 1m30s, got %dm%ds", m, s)
+	}
+
+	// Latched value is kept until the next latch
+	clock.Advance(5 * time.Second)
+	if got := readRTC(c, RTC_S); got != 30 {
+		t.Errorf("latched seconds should still be 30, got %d", got)
+	}
+
+	// Writing 0x01 without 0x00 first does not latch
+	c.Write(0x6000, 0x01)
+	if got := readRTC(c, RTC_S); got != 30 {
+		t.Errorf("latch without 0x00 write should not update, got %d", got)
+	}
+
+	latchRTC(c)
+	if got := readRTC(c, RTC_S); got != 35 {
+		t.Errorf("want 35 seconds, got %d", got)
+	}
+}
+
+func TestMBC3RTCHalt(t *testing.T) {
+	clock := &fakeTime{now: time.Unix(0, 0)}
+	c := newTestMBC3(0x10, clock)
+	c.Write(0x0000, 0x0A)
+
+	writeRTC(c, RTC_DH, 0x40)
+	clock.Advance(time.Hour)
+	latchRTC(c)
+	if got := readRTC(c, RTC_H); got != 0 {
+		t.Errorf("halted clock should not count, got %d hours", got)
+	}
+
+	writeRTC(c, RTC_DH, 0x00)
+	clock.Advance(2 * time.Hour)
+	latchRTC(c)
+	if got := readRTC(c, RTC_H); got != 2 {
+		t.Errorf("want 2 hours, got %d", got)
+	}
+}
+
+func TestMBC3RTCDayCarry(t *testing.T) {
+	clock := &fakeTime{now: time.Unix(0, 0)}
+	c := newTestMBC3(0x10, clock)
+	c.Write(0x0000, 0x0A)
+
+	writeRTC(c, RTC_H, 23)
+	writeRTC(c, RTC_M, 59)
+	writeRTC(c, RTC_S, 59)
+	writeRTC(c, RTC_DL, 0xFF)
+	writeRTC(c, RTC_DH, 0x01) // day 511
+
+	clock.Advance(time.Second)
+	latchRTC(c)
+
+	if got := readRTC(c, RTC_DL); got != 0 {
+		t.Errorf("day counter low should wrap to 0, got %d", got)
+	}
+	if got := readRTC(c, RTC_DH); got != 0x80 {
+		t.Errorf("DH should have carry set and day bit 8 cleared, want 0x80, got 0x%02X", got)
+	}
+
+	// Carry is sticky
+	clock.Advance(48 * time.Hour)
+	latchRTC(c)
+	if got := readRTC(c, RTC_DH); got != 0x80 {
+		t.Errorf("carry should stay set, got 0x%02X", got)
+	}
+	if got := readRTC(c, RTC_DL); got != 2 {
+		t.Errorf("want day 2, got %d", got)
+	}
+}
+
+func TestMBC3RTCInvalidSeconds(t *testing.T) {
+	clock := &fakeTime{now: time.Unix(0, 0)}
+	c := newTestMBC3(0x10, clock)
+	c.Write(0x0000, 0x0A)
+
+	// Out of range values count to 63 and wrap without carrying into minutes
+	writeRTC(c, RTC_S, 62)
+	clock.Advance(2 * time.Second)
+	latchRTC(c)
+
+	if s, m := readRTC(c, RTC_S), readRTC(c, RTC_M); s != 0 || m != 0 {
+		t.Errorf("want 0m0s, got %dm%ds", m, s)
+	}
+}
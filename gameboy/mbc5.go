@@ -0,0 +1,113 @@
+package gameboy
+
+// Implemented by carts with a rumble motor, so the frontend can be told when the motor turns on or off.
+type RumbleCart interface {
+	SetRumbleHandler(func(on bool))
+}
+
+// MBC5 cartridge, up to 8 MiB ROM and 128 KiB RAM.
+type MBC5 struct {
+	rom        []byte
+	ram        []byte
+	header     *CartHeader
+	romBank    int // 9 bits, bank 0 can be mapped to 4000-7FFF
+	ramBank    byte
+	ramEnabled bool
+	numOfBanks int
+
+	rumble        bool // rumble carts use bit 3 of the RAM bank register for the motor
+	motor         bool
+	rumbleHandler func(on bool)
+	batteryRAM
+}
+
+func NewMBC5(rom []byte, header *CartHeader) *MBC5 {
+	return &MBC5{
+		rom:        rom,
+		ram:        make([]byte, header.RAMBytes()),
+		header:     header,
+		romBank:    1,
+		numOfBanks: max((len(rom)+0x3FFF)/0x4000, 1),
+		rumble:     header.HasRumble(),
+	}
+}
+
+func (c *MBC5) Read(addr uint16) byte {
+	switch {
+	case addr <= 0x3FFF:
+		return c.rom[addr]
+	case addr <= 0x7FFF:
+		bank := c.romBank % c.numOfBanks
+		return c.rom[bank*0x4000+int(addr-0x4000)]
+	default:
+		if !c.ramEnabled || len(c.ram) == 0 {
+			return 0xFF
+		}
+		return c.ram[c.getRAMAddress(addr)]
+	}
+}
+
+func (c *MBC5) Write(addr uint16, data byte) {
+	switch {
+	case addr <= 0x1FFF:
+		c.ramEnabled = data&0xF == 0xA
+		if !c.ramEnabled {
+			c.ramDisabled()
+		}
+	case addr <= 0x2FFF:
+		// Lower 8 bits of ROM bank
+		c.romBank = (c.romBank & 0x100) | int(data)
+	case addr <= 0x3FFF:
+		// Bit 8 of ROM bank
+		c.romBank = (c.romBank & 0xFF) | int(data&0x1)<<8
+	case addr <= 0x5FFF:
+		if c.rumble {
+			c.setMotor(data&0x08 != 0)
+			c.ramBank = data & 0x07
+		} else {
+			c.ramBank = data & 0x0F
+		}
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		if c.ramEnabled && len(c.ram) > 0 {
+			c.ram[c.getRAMAddress(addr)] = data
+			c.ramWritten()
+		}
+	}
+}
+
+func (c *MBC5) Header() *CartHeader {
+	return c.header
+}
+
+func (c *MBC5) SaveData() []byte {
+	c.saved()
+	return append([]byte{}, c.ram...)
+}
+
+func (c *MBC5) LoadSaveData(data []byte) {
+	copy(c.ram, data)
+}
+
+func (c *MBC5) SetRumbleHandler(handler func(on bool)) {
+	c.rumbleHandler = handler
+}
+
+// Motor state, for polling instead of using a handler.
+func (c *MBC5) Motor() bool {
+	return c.motor
+}
+
+// Notify the handler only when the motor changes state.
+func (c *MBC5) setMotor(on bool) {
+	if on == c.motor {
+		return
+	}
+	c.motor = on
+	if c.rumbleHandler != nil {
+		c.rumbleHandler(on)
+	}
+}
+
+func (c *MBC5) getRAMAddress(addr uint16) int {
+	return (int(c.ramBank)*0x2000 + int(addr-0xA000)) % len(c.ram)
+}
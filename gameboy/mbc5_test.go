@@ -0,0 +1,85 @@
+package gameboy
+
+import (
+	"testing"
+)
+
+func newTestMBC5(cartType byte) *MBC5 {
+	rom := newTestHeaderRom(cartType, 0x08, 0x04) // 512 banks, 128 KiB RAM
+	for bank := 0; bank < len(rom)/0x4000; bank++ {
+		rom[bank*0x4000+0x200] = byte(bank)
+		rom[bank*0x4000+0x201] = byte(bank >> 8)
+	}
+	header, _ := ParseHeader(rom)
+	return NewMBC5(rom, header)
+}
+
+func TestMBC5ROMBanking(t *testing.T) {
+	c := newTestMBC5(0x1B)
+
+	testCases := []struct {
+		lo, hi byte
+		want   int
+	}{
+		{lo: 0x01, hi: 0x00, want: 0x001},
+		{lo: 0x00, hi: 0x00, want: 0x000}, // bank 0 is allowed
+		{lo: 0xFF, hi: 0x00, want: 0x0FF},
+		{lo: 0x00, hi: 0x01, want: 0x100},
+		{lo: 0xFF, hi: 0x01, want: 0x1FF},
+		{lo: 0x23, hi: 0xFE, want: 0x023}, // only bit 0 of the high register
+	}
+
+	for _, tt := range testCases {
+		c.Write(0x2000, tt.lo)
+		c.Write(0x3000, tt.hi)
+		got := int(c.Read(0x4200)) | int(c.Read(0x4201))<<8
+		if got != tt.want {
+			t.Errorf("lo 0x%02X hi 0x%02X: want bank 0x%03X, got 0x%03X", tt.lo, tt.hi, tt.want, got)
+		}
+	}
+}
+
+func TestMBC5RAMBanking(t *testing.T) {
+	c := newTestMBC5(0x1B)
+	c.Write(0x0000, 0x0A)
+
+	for bank := byte(0); bank < 16; bank++ {
+		c.Write(0x4000, bank)
+		c.Write(0xA010, 0x40+bank)
+	}
+	for bank := byte(0); bank < 16; bank++ {
+		c.Write(0x4000, bank)
+		if got := c.Read(0xA010); got != 0x40+bank {
+			t.Errorf("bank %d: want 0x%02X, got 0x%02X", bank, 0x40+bank, got)
+		}
+	}
+}
+
+func TestMBC5Rumble(t *testing.T) {
+	c := newTestMBC5(0x1E)
+	c.Write(0x0000, 0x0A)
+
+	events := []bool{}
+	c.SetRumbleHandler(func(on bool) {
+		events = append(events, on)
+	})
+
+	c.Write(0x4000, 0x08)
+	c.Write(0x4000, 0x09) // motor already on, no event
+	c.Write(0x4000, 0x01)
+
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Errorf("want motor events [true false], got %v", events)
+	}
+
+	// Bit 3 is not part of the RAM bank on rumble carts
+	c.Write(0x4000, 0x01)
+	c.Write(0xA000, 0x55)
+	c.Write(0x4000, 0x09)
+	if got := c.Read(0xA000); got != 0x55 {
+		t.Errorf("bank 9 should map to bank 1 on rumble carts, want 0x55, got 0x%02X", got)
+	}
+	if !c.Motor() {
+		t.Errorf("motor should be on")
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package gameboy
 
 import "log"
 import "fmt"
@@ -324,6 +324,10 @@ var mainLookup map[byte]Instruction = map[byte]Instruction{
 
 var prefixedLookup map[byte]Instruction = make(map[byte]Instruction)
 
+func init() {
+	populatePrefixLookup()
+}
+
 func populatePrefixLookup() {
 	for op := 0x0; op <= 0xFF; op++ {
 		prefixedLookup[byte(op)] = getPrefixInstructionFromOp(byte(op))
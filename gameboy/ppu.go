@@ -1,8 +1,8 @@
-package main
+package gameboy
 
 import (
 	utils "github.com/mikzorz/goboy-emu/helpers"
-	"sort"
+	"slices"
 )
 
 type PPU struct {
@@ -20,14 +20,21 @@ type PPU struct {
 	bgFetcher                                              BGFetcher
 	fetchingObject                                         bool // currently fetching object pixel data
 	objectToFetch                                          byte // oam index of object to be fetched
-	fetchStep                                              int
+	objFetchStep                                           int
+	fetchStep                                              int  // background fetcher
 	fetcherReset                                           bool // for reseting background fetcher at beginning of each scanline
-	tileID, tileLow, tileHigh                              byte
+	tileID, tileLow, tileHigh                              byte // background fetcher
+	tileTrim                                               byte // pixels dropped from the tile being fetched
+	resumeTrim                                             byte // tileTrim for the first background tile after the window is disabled
+	objTileID, objTileLow, objTileHigh                     byte
 	oldConditionState                                      byte
 	windowLineCounter                                      byte
 	windowReached                                          bool
+	windowStartX                                           byte // LCD x that the window last started at
 	belowWindowTop                                         bool
 	fetchingWindow                                         bool
+	firstLineAfterOn                                       bool // the OAM scan of the first line after turning on reads as mode 0
+	frames                                                 uint // frames completed, counted on entering VBlank
 }
 
 type ppuMode string
@@ -57,18 +64,9 @@ func (p *PPU) Cycle() {
 	// if LCD/PPU are enabled
 	if utils.IsBitSet(7, p.LCDC) {
 
-		if p.dot == 0 {
-			if p.LY == p.LYC {
-				p.STAT |= 0b100
-			} else {
-				p.STAT &= 0xFB
-			}
-
-			p.oldConditionState = 0
-			p.STATInterrupt() // STATInterrupt will enable or disable LYC bit of STAT as required
-		}
-
+		p.compareLYC()
 		p.setMode()
+		p.STATInterrupt()
 
 		switch p.mode {
 		case MODE_OAMSCAN:
@@ -81,22 +79,19 @@ func (p *PPU) Cycle() {
 			}
 		case MODE_DRAWING:
 			// Drawing to LCD
-			// TODO
-			// Window
+			// Mode 3 ends when the LCD has shifted out 160 pixels, so it takes 172 dots,
+			// plus SCX%8 discarded pixels, 6 dots to start the window and 6-11 dots per object.
+			p.checkIfWindowReached()
 
 			p.objFetcher.Cycle(p)
 			p.bgFetcher.Cycle(p)
 
-			p.checkIfWindowReached()
-
 		case MODE_HBLANK:
 			// H-Blank
 		case MODE_VBLANK:
 			// V-Blank
 		}
 
-		// TODO: for monochrome gb, LCD interrupt sometimes triggers during modes 0,1,2 or LY==LYC when writing to STAT (even $00). It behaves as if $FF is written for 1 M-cycle, then the actual written data the next M-cycle.
-
 		p.dot++
 
 		if p.dot >= 456 {
@@ -107,11 +102,53 @@ func (p *PPU) Cycle() {
 		if p.LY > 153 {
 			p.LY = 0
 		}
-	} else {
-		// TODO blank the screen. keep blank until next frame
 	}
 }
 
+// Called on writes to LCDC, LCDC.7 turns the LCD and PPU off and on.
+func (p *PPU) setLCDC(data byte) {
+	wasOn := utils.IsBitSet(7, p.LCDC)
+	p.LCDC = data
+	on := utils.IsBitSet(7, data)
+
+	if wasOn && !on {
+		p.turnOff()
+	} else if !wasOn && on {
+		// The first frame after turning on is drawn but not shown
+		p.bus.lcd.skipFrame = true
+		p.firstLineAfterOn = true
+	}
+}
+
+// While off, LY and the STAT mode read 0, VRAM and OAM are free to access and the screen is white.
+// Turning on starts again from the beginning of line 0.
+func (p *PPU) turnOff() {
+	p.LY = 0
+	p.dot = 0
+	p.mode = MODE_HBLANK
+	p.STAT &= 0xFC
+	p.oldConditionState = 0
+	p.firstLineAfterOn = false
+
+	p.bgFIFO.Clear()
+	p.objFIFO.Clear()
+	p.savedObjects = []byte{}
+	p.oamScanI = 0
+	p.fetchingObject = false
+	p.fetchStep = 0
+	p.fetcherReset = false
+	p.tileTrim, p.resumeTrim = 0, 0
+	p.x = 0
+	p.windowLineCounter = 0
+	p.windowReached = false
+	p.belowWindowTop = false
+	p.fetchingWindow = false
+	p.bus.lcd.SetX(0)
+	p.bus.lcd.SetPixelsToDiscard(0)
+
+	p.bus.lcd.blank()
+}
+
 func (p *PPU) Read(addr uint16) byte {
 	// TODO, if mode == oam scan, vram can be read if index 37 has been reached
 	if addr >= 0x8000 && addr <= 0x9FFF && p.mode != MODE_DRAWING {
@@ -149,21 +186,24 @@ func (p *PPU) setMode() {
 	if p.LY < 144 {
 		if p.dot == 0 {
 			p.mode = MODE_OAMSCAN
-			p.STAT = (p.STAT & 0xFC) | 0x02
+			if !p.firstLineAfterOn {
+				p.STAT = (p.STAT & 0xFC) | 0x02
+			}
 
 			p.windowReached = false
+			p.fetchingWindow = false
 			if p.WY == p.LY {
 				p.belowWindowTop = true
 			}
 
 			p.savedObjects = []byte{}
 			p.oamScanI = 0
-			p.STATInterrupt()
 		} else if p.dot == 80 {
 			p.mode = MODE_DRAWING
+			p.firstLineAfterOn = false
 			p.STAT = (p.STAT & 0xFC) | 0x03
 			p.bus.lcd.SetPixelsToDiscard(p.SCX % 8)
-		} else if int32(p.bus.lcd.GetX()) >= TRUEWIDTH && p.mode != MODE_HBLANK {
+		} else if int(p.bus.lcd.GetX()) >= p.bus.lcd.Width() && p.mode != MODE_HBLANK {
 			p.mode = MODE_HBLANK
 			p.STAT = (p.STAT & 0xFC)
 
@@ -171,13 +211,12 @@ func (p *PPU) setMode() {
 			p.objFIFO.Clear()
 			p.fetchStep = 0
 			p.fetcherReset = false
+			p.tileTrim, p.resumeTrim = 0, 0
 			p.x = 0
 			p.bus.lcd.SetX(0)
 			if p.windowReached {
 				p.windowLineCounter++
 			}
-
-			p.STATInterrupt()
 		}
 	} else {
 		if p.mode != MODE_VBLANK {
@@ -185,8 +224,9 @@ func (p *PPU) setMode() {
 			p.belowWindowTop = false
 			p.windowLineCounter = 0
 			p.STAT = (p.STAT & 0xFC) | 0x01
-			p.STATInterrupt()
 			p.bus.InterruptRequest(VBLANK_INTR)
+			p.bus.lcd.swapBuffers()
+			p.frames++
 		}
 
 	}
@@ -221,12 +261,30 @@ func (p *PPU) objectRowOnScanline(objY, scanline, scroll byte) byte {
 	return 16 + scanline - objY
 }
 
+// Row of the object being fetched that is on the current scanline, after Y-flip.
+// 0-7, or 0-15 for 8x16 objects.
+func (p *PPU) objectRow() byte {
+	row := p.objectRowOnScanline(p.bus.dma.oam[p.objectToFetch], p.LY, p.SCY)
+	if utils.IsBitSet(6, p.bus.dma.oam[p.objectToFetch+3]) {
+		spriteSize := byte(8)
+		if utils.IsBitSet(2, p.LCDC) {
+			spriteSize = 16
+		}
+		row = spriteSize - 1 - row
+	}
+	return row
+}
+
+// Objects are kept in DMG priority order: lowest x first, then lowest OAM index.
+// OAM is scanned in order, so an object goes after every saved object with the same x.
+// They are fetched in this order, and the object FIFO keeps the pixels fetched first.
 func (p *PPU) saveObjectIndex(idx byte) {
-	p.savedObjects = append(p.savedObjects, idx)
-	// Sort objects from lowest x to highest
-	sort.Slice(p.savedObjects, func(i, j int) bool {
-		return p.bus.dma.oam[p.savedObjects[i]+1] < p.bus.dma.oam[p.savedObjects[j]+1]
-	})
+	x := p.bus.dma.oam[idx+1]
+	i := len(p.savedObjects)
+	for i > 0 && p.bus.dma.oam[p.savedObjects[i-1]+1] > x {
+		i--
+	}
+	p.savedObjects = slices.Insert(p.savedObjects, i, idx)
 }
 
 // Check first object of ppu.savedObjects, if object's X is within current tile, return the oam index of the object and TRUE, else return 0 and FALSE
@@ -303,27 +361,106 @@ func (p *PPU) mergeTileBytes(hi, lo byte) []Pixel {
 	return data
 }
 
+// The window starts when the LCD reaches WX-7, WX 0-6 start it at the left edge.
+// The background FIFO is cleared and the fetcher restarts with window tiles, the LCD waits 6 dots for the first one.
+// LCDC.5 and WX are checked every dot: clearing LCDC.5 switches the fetcher back to background tiles,
+// and if WX is changed so that it matches again later on the line, the window restarts from its first tile.
 func (p *PPU) checkIfWindowReached() {
+	x := p.bus.lcd.GetX()
+
+	if !utils.IsBitSet(5, p.LCDC) {
+		if p.fetchingWindow {
+			// Background tiles follow the pixels that are already in the FIFO, and the window tile
+			// being fetched if its id has been read. The first one is trimmed to line up with SCX,
+			// as the SCX%8 discard only happens at the start of the line.
+			p.fetchingWindow = false
+			resumeX := x + byte(len(*p.bgFIFO))
+			if p.fetchStep > 1 {
+				resumeX += 8
+			}
+			fine := (resumeX + p.SCX) % 8
+			p.x = resumeX - fine // on the background's tile grid, the tile map column is (p.x+SCX)/8
+			if p.fetchStep > 1 {
+				p.x -= 8 // pushing the window tile adds 8
+			}
+			p.resumeTrim = fine
+		}
+		return
+	}
 
-	if utils.IsBitSet(5, p.LCDC) && p.belowWindowTop && p.x+7 >= p.WX {
+	if !p.belowWindowTop || (p.windowReached && x == p.windowStartX) {
+		return
+	}
+	if x+7 == p.WX || (x == 0 && p.WX < 7) {
+		p.windowReached = true
+		p.windowStartX = x
 		p.fetchingWindow = true
+		p.x = 0
+		p.bgFIFO.Clear()
+		p.fetchStep = 0
+		// The window isn't scrolled
+		p.bus.lcd.SetPixelsToDiscard(0)
+	}
+}
 
-		if !p.windowReached {
-			p.windowReached = true
-			p.x = 0
-			p.bgFIFO.Clear()
-			p.fetchStep = 0
-		}
+// An object fetch can start once the background fetcher has fetched its tile's low byte,
+// and there are background pixels to mix the object with.
+func (p *PPU) objectFetchReady() bool {
+	return p.fetchStep >= 4 && p.bgFIFO.CanPop()
+}
+
+// The line that LYC is compared with, -1 for none.
+// The comparison sees a new line 4 dots after LY changes, except for line 0.
+// Line 153 reads as 0 after its first 4 dots, and matches LYC=0 from dot 12.
+func (p *PPU) lyForCompare() int {
+	switch {
+	case p.LY == 0:
+		return 0
+	case p.LY == 153 && p.dot >= 12:
+		return 0
+	case p.LY == 153 && p.dot >= 8:
+		return -1
+	case p.dot < 4:
+		return -1
+	}
+	return int(p.LY)
+}
+
+// Called every dot while the LCD is on, keeps STAT.2 up to date. It keeps its value while the LCD is off.
+func (p *PPU) compareLYC() {
+	if ly := p.lyForCompare(); ly >= 0 && byte(ly) == p.LYC {
+		p.STAT |= 0b100
 	} else {
-		p.fetchingWindow = false
+		p.STAT &= 0xFB
+	}
+}
+
+// The value read from FF44
+func (p *PPU) readLY() byte {
+	if p.LY == 153 && p.dot >= 4 {
+		return 0
+	}
+	return p.LY
+}
+
+// Only bits 3-6 can be written.
+// On DMG, the write acts as if 0xFF was written for one M-cycle first, which requests a STAT interrupt
+// if the LCD is on and it is in mode 0, 1 or 2 or LY=LYC, unless one of the selected conditions was already met.
+func (p *PPU) writeSTAT(data byte) {
+	if utils.IsBitSet(7, p.LCDC) {
+		p.STAT |= 0x78
+		p.STATInterrupt()
 	}
+	p.STAT = (p.STAT & 0x87) | (data & 0x78)
 }
 
-// If condition is met when no conditions were met before, trigger STAT interrupt
+// The STAT interrupt line is high while any selected condition is met. A rising edge requests the interrupt,
+// so while one condition holds the line high, others becoming true don't request it again (STAT blocking).
+// Called every dot while the LCD is on.
 func (p *PPU) STATInterrupt() {
 	var conditionState byte
 
-	if p.LY == p.LYC {
+	if utils.IsBitSet(2, p.STAT) {
 		if utils.IsBitSet(6, p.STAT) {
 			conditionState |= (1 << 6)
 		}
@@ -331,7 +468,8 @@ func (p *PPU) STATInterrupt() {
 
 	switch p.mode {
 	case MODE_OAMSCAN:
-		if utils.IsBitSet(5, p.STAT) {
+		// Not on the first line after turning on, STAT reads mode 0 then
+		if utils.IsBitSet(5, p.STAT) && !p.firstLineAfterOn {
 			conditionState |= (1 << 5)
 		}
 	case MODE_HBLANK:
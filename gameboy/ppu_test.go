@@ -0,0 +1,524 @@
+package gameboy
+
+import (
+	"slices"
+	"testing"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+func TestGetMapTileCoords(t *testing.T) {
+	// Given an x, y, scx & scy, get tileX, tileY.
+	testCases := []struct {
+		x, y, scx, scy byte
+		tx, ty         byte
+	}{
+		{x: 0, y: 0, scx: 0, scy: 0, tx: 0, ty: 0},
+		{x: 1, y: 0, scx: 0, scy: 0, tx: 0, ty: 0},
+		{x: 8, y: 0, scx: 0, scy: 0, tx: 1, ty: 0},
+		{x: 255, y: 0, scx: 1, scy: 0, tx: 0, ty: 0}, //wrap x
+		{x: 0, y: 0, scx: 16, scy: 0, tx: 2, ty: 0},
+		{x: 0, y: 8, scx: 0, scy: 0, tx: 0, ty: 1},
+		{x: 0, y: 8, scx: 0, scy: 8, tx: 0, ty: 2},
+		{x: 0, y: 255, scx: 0, scy: 1, tx: 0, ty: 0},
+		{x: 24, y: 24, scx: 8, scy: 8, tx: 4, ty: 4},
+		{x: 255, y: 255, scx: 255, scy: 255, tx: 31, ty: 31}, // wrap x and y
+	}
+
+	ppu := NewPPU()
+
+	for _, tt := range testCases {
+		tx, ty := ppu.getTileCoords(tt.x, tt.y, tt.scx, tt.scy)
+
+		if tx != tt.tx {
+			t.Errorf("wrong tileX: got %d, want %d", tx, tt.tx)
+		}
+
+		if ty != tt.ty {
+			t.Errorf("wrong tileY: got %d, want %d", ty, tt.ty)
+		}
+	}
+}
+
+func TestSaveObjectIndexPriority(t *testing.T) {
+	m := newTestMachine(t, nil)
+	p := m.bus.ppu
+	oam := &m.bus.dma.oam
+
+	// OAM index (4 byte steps) -> x
+	xs := []byte{50, 20, 50, 10, 20}
+	for i, x := range xs {
+		oam[i*4+1] = x
+	}
+	for i := range xs {
+		p.saveObjectIndex(byte(i * 4))
+	}
+
+	want := []byte{12, 4, 16, 0, 8}
+	if !slices.Equal(p.savedObjects, want) {
+		t.Errorf("wrong object order: got %v, want %v", p.savedObjects, want)
+	}
+}
+
+func TestObjectYFlip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tall     bool // 8x16
+		flags    byte
+		ly       byte
+		wantTile byte
+		wantLo   byte
+	}{
+		{name: "8x8 top row", ly: 0, wantTile: 2, wantLo: 0x20},
+		{name: "8x8 top row flipped", flags: 0x40, ly: 0, wantTile: 2, wantLo: 0x27},
+		{name: "8x8 bottom row flipped", flags: 0x40, ly: 7, wantTile: 2, wantLo: 0x20},
+		{name: "8x16 top row", tall: true, ly: 0, wantTile: 2, wantLo: 0x20},
+		{name: "8x16 bottom row", tall: true, ly: 15, wantTile: 3, wantLo: 0x37},
+		{name: "8x16 top row flipped", tall: true, flags: 0x40, ly: 0, wantTile: 3, wantLo: 0x37},
+		{name: "8x16 bottom row flipped", tall: true, flags: 0x40, ly: 15, wantTile: 2, wantLo: 0x20},
+		{name: "8x16 row 7 flipped", tall: true, flags: 0x40, ly: 7, wantTile: 3, wantLo: 0x30},
+	}
+
+	for _, tt := range testCases {
+		m := newTestMachine(t, nil)
+		p := m.bus.ppu
+		// Each row's low byte is tile<<4 | row
+		for tile := 2; tile <= 3; tile++ {
+			for row := 0; row < 8; row++ {
+				p.vram[tile*16+row*2] = byte(tile<<4 | row)
+			}
+		}
+		p.LCDC = 0x91
+		if tt.tall {
+			p.LCDC |= 0x04
+		}
+		p.LY = tt.ly
+		p.objectToFetch = 0
+		copy(m.bus.dma.oam[:], []byte{16, 8, 2, tt.flags}) // y, x, tile, flags. Tile 2 or 3 for 8x16.
+
+		for _, step := range []int{1, 3, 5} {
+			p.objFetchStep = step
+			p.objFetcher.Step(p)
+		}
+
+		if p.objTileID != tt.wantTile {
+			t.Errorf("%s: wrong tile: got %d, want %d", tt.name, p.objTileID, tt.wantTile)
+		}
+		if p.objTileLow != tt.wantLo {
+			t.Errorf("%s: wrong tile row: got 0x%02X, want 0x%02X", tt.name, p.objTileLow, tt.wantLo)
+		}
+	}
+}
+
+func TestPushObjectKeepsEarlierPixels(t *testing.T) {
+	f := NewFIFO()
+	f.PushObject([]Pixel{{c: 1}, {c: 0}, {c: 1}, {c: 0}})
+	f.PushObject([]Pixel{{c: 2}, {c: 2}, {c: 2}, {c: 2}, {c: 2}, {c: 2}})
+
+	want := []byte{1, 2, 1, 2, 2, 2}
+	if len(*f) != len(want) {
+		t.Fatalf("wrong FIFO length: got %d, want %d", len(*f), len(want))
+	}
+	for i, pix := range *f {
+		if pix.c != want[i] {
+			t.Errorf("pixel %d: got colour %d, want %d", i, pix.c, want[i])
+		}
+	}
+}
+
+func TestMode3Length(t *testing.T) {
+	testCases := []struct {
+		name    string
+		scx     byte
+		wx      byte // 0 for no window
+		lcdc    byte
+		objects []byte // x of each object
+		want    int
+	}{
+		{name: "no penalties", want: 172},
+		{name: "SCX 3", scx: 3, want: 175},
+		{name: "SCX 7", scx: 7, want: 179},
+		{name: "SCX 8", scx: 8, want: 172},
+		{name: "window", wx: 87, want: 178},
+		{name: "window mid tile", wx: 90, want: 178},
+		{name: "object at tile pixel 0", objects: []byte{8}, want: 183},
+		{name: "object at tile pixel 3", objects: []byte{11}, want: 180},
+		{name: "object at tile pixel 5", objects: []byte{13}, want: 178},
+		{name: "object at tile pixel 7", objects: []byte{15}, want: 178},
+		{name: "object X 0", objects: []byte{0}, want: 183},
+		{name: "object scrolled to tile pixel 3", scx: 3, objects: []byte{8}, want: 183},
+		{name: "objects in the same tile", objects: []byte{8, 10}, want: 189},
+		{name: "objects at the same x", objects: []byte{8, 8}, want: 189},
+		{name: "objects in different tiles", objects: []byte{8, 48}, want: 194},
+		{name: "object off the right edge", objects: []byte{168}, want: 172},
+		{name: "objects disabled", lcdc: 0x91, objects: []byte{8}, want: 172},
+	}
+
+	for _, tt := range testCases {
+		m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+		p := m.bus.ppu
+		for m.PPU().LY != 9 {
+			m.Tick()
+		}
+
+		p.LCDC = 0x93
+		if tt.lcdc != 0 {
+			p.LCDC = tt.lcdc
+		}
+		p.SCX = tt.scx
+		if tt.wx != 0 {
+			p.LCDC |= 0x20
+			p.WX, p.WY = tt.wx, 0
+		}
+		for i, x := range tt.objects {
+			copy(m.bus.dma.oam[i*4:], []byte{16 + 9, x, 0, 0})
+		}
+
+		for p.mode != MODE_DRAWING {
+			m.Tick()
+		}
+		got := 0
+		for p.mode == MODE_DRAWING {
+			m.Tick()
+			got++
+		}
+		if got != tt.want {
+			t.Errorf("%s: mode 3 took %d dots, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestObjectDrawnAtX(t *testing.T) {
+	for _, scx := range []byte{0, 3} {
+		m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+		p := m.bus.ppu
+		for i := 16; i < 32; i++ {
+			p.vram[i] = 0xFF // tile 1 is solid colour 3
+		}
+		p.LCDC = 0x93
+		p.SCX = scx
+		p.BGP, p.OBP0 = 0x00, 0xFF
+		copy(m.bus.dma.oam[:], []byte{16, 20, 1, 0, 16, 24, 1, 0}) // overlapping objects
+
+		m.RunFrame()
+		m.RunFrame()
+		row := m.Framebuffer()[:SCREEN_WIDTH]
+		for x, shade := range row {
+			want := byte(0)
+			if x >= 12 && x < 24 {
+				want = 3
+			}
+			if shade != want {
+				t.Errorf("SCX %d, x %d: got shade %d, want %d", scx, x, shade, want)
+			}
+		}
+	}
+}
+
+// Registers written during mode 3 of one line, at the dot a CPU write would land on.
+func TestMidScanlineWrites(t *testing.T) {
+	const line = 10
+	pixelDot := func(x int) int { return 92 + x } // the dot that pixel x is shifted out on, with no penalties
+	all := []int{}
+	for col := 0; col < 32; col++ {
+		all = append(all, col)
+	}
+
+	type write struct {
+		dot  int
+		addr uint16
+		data byte
+	}
+	testCases := []struct {
+		name               string
+		lcdc, bgp, wx, scx byte
+		bgMap, winMap      []int // map columns with solid tiles
+		writes             []write
+		black              func(x int) bool
+	}{
+		{
+			name: "BGP", lcdc: 0x91, bgp: 0x00, wx: 167,
+			writes: []write{{pixelDot(50), 0xFF47, 0xFF}},
+			black:  func(x int) bool { return x >= 50 },
+		},
+		{
+			name: "BG disabled", lcdc: 0x91, bgp: 0xFF, wx: 167,
+			writes: []write{{pixelDot(100), 0xFF40, 0x90}},
+			black:  func(x int) bool { return x < 100 },
+		},
+		{
+			name: "SCX", lcdc: 0x91, bgp: 0xE4, wx: 167, bgMap: []int{10},
+			writes: []write{{pixelDot(40), 0xFF43, 16}},
+			black:  func(x int) bool { return x >= 64 && x < 72 },
+		},
+		{
+			name: "window disabled", lcdc: 0xF1, bgp: 0xE4, wx: 7, winMap: all,
+			writes: []write{{pixelDot(40), 0xFF40, 0xD1}},
+			black:  func(x int) bool { return x < 48 },
+		},
+		{
+			// Background columns 6 and 7 cover x 45-52 and 53-60
+			name: "window disabled with SCX", lcdc: 0xF1, bgp: 0xE4, wx: 7, scx: 3, bgMap: []int{7}, winMap: all,
+			writes: []write{{pixelDot(40), 0xFF40, 0xD1}},
+			black:  func(x int) bool { return x < 48 || (x >= 53 && x < 61) },
+		},
+		{
+			name: "window enabled", lcdc: 0xD1, bgp: 0xE4, wx: 87, winMap: all,
+			writes: []write{{pixelDot(20), 0xFF40, 0xF1}},
+			black:  func(x int) bool { return x >= 80 },
+		},
+		{
+			name: "WX retriggers the window", lcdc: 0xF1, bgp: 0xE4, wx: 7, winMap: []int{0},
+			writes: []write{{pixelDot(20), 0xFF4B, 87}},
+			black:  func(x int) bool { return x < 8 || (x >= 80 && x < 88) },
+		},
+		{
+			name: "WX behind the LCD", lcdc: 0xF1, bgp: 0xE4, wx: 167, winMap: all,
+			writes: []write{{pixelDot(60), 0xFF4B, 47}},
+			black:  func(x int) bool { return false },
+		},
+	}
+
+	for _, tt := range testCases {
+		m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+		p := m.bus.ppu
+		m.RunFrame()
+		for p.LY != 0 {
+			m.Tick()
+		}
+
+		for i := 16; i < 32; i++ {
+			p.vram[i] = 0xFF // tile 1 is solid colour 3
+		}
+		for row := 0; row < 32; row++ {
+			for _, col := range tt.bgMap {
+				p.vram[0x1800+row*32+col] = 1
+			}
+			for _, col := range tt.winMap {
+				p.vram[0x1C00+row*32+col] = 1
+			}
+		}
+		p.LCDC, p.BGP, p.SCX = tt.lcdc, tt.bgp, tt.scx
+		p.WX, p.WY = tt.wx, 0
+
+		for _, w := range tt.writes {
+			for p.LY != line || p.dot != w.dot {
+				m.Tick()
+			}
+			m.bus.Write(w.addr, w.data)
+		}
+		m.RunFrame()
+
+		row := m.Framebuffer()[line*SCREEN_WIDTH : (line+1)*SCREEN_WIDTH]
+		for x, shade := range row {
+			want := byte(0)
+			if tt.black(x) {
+				want = 3
+			}
+			if shade != want {
+				t.Errorf("%s: x %d: got shade %d, want %d", tt.name, x, shade, want)
+			}
+		}
+	}
+}
+
+// Tick until the PPU is about to run the given dot of line ly
+func runToDot(m *Machine, ly byte, dot int) {
+	p := m.bus.ppu
+	for p.LY != ly || p.dot != dot {
+		m.Tick()
+	}
+}
+
+func TestSTATWrite(t *testing.T) {
+	m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+	runToDot(m, 20, 100)                       // mode 3
+
+	before := m.Read(0xFF41)
+	m.bus.Write(0xFF41, 0x00)
+	if got := m.Read(0xFF41); got != before&0x87 {
+		t.Errorf("after writing 0x00: got 0x%02X, want 0x%02X", got, before&0x87)
+	}
+	if got := m.Read(0xFF41); got&0x83 != 0x83 {
+		t.Errorf("bit 7 and mode 3 should read back: got 0x%02X", got)
+	}
+	m.bus.Write(0xFF41, 0xFF)
+	if got := m.Read(0xFF41); got != before|0x78 {
+		t.Errorf("after writing 0xFF: got 0x%02X, want 0x%02X", got, before|0x78)
+	}
+
+	// Writing LYC sets the coincidence bit, not the mode
+	m.bus.Write(0xFF41, 0x00)
+	m.bus.Write(0xFF45, 20)
+	m.Tick()
+	if got := m.Read(0xFF41); got != 0x87 {
+		t.Errorf("after writing LYC=LY: got 0x%02X, want 0x87", got)
+	}
+}
+
+func TestSTATWriteQuirk(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ly       byte
+		dot      int
+		lyc      byte
+		lcdOff   bool
+		wantIntr bool
+	}{
+		{name: "HBlank", ly: 20, dot: 300, lyc: 0xFF, wantIntr: true},
+		{name: "VBlank", ly: 150, dot: 100, lyc: 0xFF, wantIntr: true},
+		{name: "OAM scan", ly: 20, dot: 40, lyc: 0xFF, wantIntr: true},
+		{name: "mode 3", ly: 20, dot: 100, lyc: 0xFF, wantIntr: false},
+		{name: "mode 3, LY=LYC", ly: 20, dot: 100, lyc: 20, wantIntr: true},
+		{name: "LCD off", ly: 20, dot: 300, lyc: 0xFF, lcdOff: true, wantIntr: false},
+	}
+
+	for _, tt := range testCases {
+		m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+		m.bus.Write(0xFF45, tt.lyc)
+		runToDot(m, tt.ly, tt.dot)
+		if tt.lcdOff {
+			m.bus.Write(0xFF40, 0x11)
+		}
+		m.bus.cpu.IF = 0
+
+		m.bus.Write(0xFF41, 0x00)
+		if got := utils.IsBitSet(int(STAT_INTR), m.bus.cpu.IF); got != tt.wantIntr {
+			t.Errorf("%s: STAT interrupt requested = %v, want %v", tt.name, got, tt.wantIntr)
+		}
+	}
+}
+
+func TestLYCCompareTiming(t *testing.T) {
+	m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+	coincidence := func() bool { return utils.IsBitSet(2, m.Read(0xFF41)) }
+
+	m.bus.Write(0xFF45, 20)
+	runToDot(m, 20, 4)
+	if coincidence() {
+		t.Errorf("LY=LYC before the comparison sees line 20")
+	}
+	m.Tick()
+	if !coincidence() {
+		t.Errorf("LY=LYC not set 4 dots into line 20")
+	}
+
+	// Line 153 reads as 0 early
+	runToDot(m, 153, 3)
+	if got := m.Read(0xFF44); got != 153 {
+		t.Errorf("LY at line 153 dot 3: got %d, want 153", got)
+	}
+	m.Tick()
+	if got := m.Read(0xFF44); got != 0 {
+		t.Errorf("LY at line 153 dot 4: got %d, want 0", got)
+	}
+
+	m.bus.Write(0xFF45, 153)
+	runToDot(m, 153, 5)
+	if !coincidence() {
+		t.Errorf("LYC=153 not matched at line 153")
+	}
+	m.bus.Write(0xFF45, 0)
+	runToDot(m, 153, 12)
+	if coincidence() {
+		t.Errorf("LYC=0 matched before dot 12 of line 153")
+	}
+	m.Tick()
+	if !coincidence() {
+		t.Errorf("LYC=0 not matched at dot 12 of line 153")
+	}
+}
+
+func TestSTATInterruptBlocking(t *testing.T) {
+	m := newTestMachine(t, []byte{0x18, 0xFE}) // JR -2
+	statRequested := func() bool { return utils.IsBitSet(int(STAT_INTR), m.bus.cpu.IF) }
+
+	// HBlank and OAM scan selected, HBlank holds the line high into the next line's OAM scan
+	m.bus.Write(0xFF45, 0xFF)
+	runToDot(m, 20, 100)
+	m.bus.Write(0xFF41, 0x28)
+	m.bus.cpu.IF = 0
+	runToDot(m, 20, 300)
+	if !statRequested() {
+		t.Errorf("no STAT interrupt at HBlank")
+	}
+	m.bus.cpu.IF = 0
+	runToDot(m, 21, 10)
+	if statRequested() {
+		t.Errorf("OAM scan requested a STAT interrupt straight after HBlank")
+	}
+
+	// Without HBlank selected, OAM scan requests it
+	runToDot(m, 21, 100)
+	m.bus.Write(0xFF41, 0x20)
+	m.bus.cpu.IF = 0
+	runToDot(m, 22, 10)
+	if !statRequested() {
+		t.Errorf("no STAT interrupt at OAM scan")
+	}
+}
+
+// BGP written by the CPU from the LY=LYC interrupt handler, so the write lands during mode 3 with
+// the CPU's real timing: interrupt dispatch, the handler's instructions and the M-cycle of the write.
+func TestMidScanlineWriteFromInterrupt(t *testing.T) {
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x40:], []byte{ // VBlank
+		0xAF,       // XOR A
+		0xE0, 0x47, // LDH (BGP), A
+		0xD9, // RETI
+	})
+	copy(rom[0x48:], []byte{ // STAT, runs over the unused vectors
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // NOP x20, into mode 3
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x3E, 0xFF, // LD A, 0xFF
+		0xE0, 0x47, // LDH (BGP), A
+		0xD9, // RETI
+	})
+	copy(rom[0x100:], []byte{
+		0xF3,       // DI
+		0x3E, 0x40, // LD A, 0x40 ; LY=LYC selected
+		0xE0, 0x41, // LDH (STAT), A
+		0x3E, 10, // LD A, 10
+		0xE0, 0x45, // LDH (LYC), A
+		0x3E, 0x03, // LD A, 0x03 ; VBlank and STAT
+		0xE0, 0xFF, // LDH (IE), A
+		0xAF,       // XOR A
+		0xE0, 0x0F, // LDH (IF), A
+		0xE0, 0x47, // LDH (BGP), A
+		0xFB,       // EI
+		0x76,       // HALT
+		0x18, 0xFD, // JR -3
+	})
+	m, err := New(rom, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		m.RunFrame()
+	}
+
+	fb := m.Framebuffer()
+	rowShades := func(ly int) []byte { return fb[ly*SCREEN_WIDTH : (ly+1)*SCREEN_WIDTH] }
+	for x, shade := range rowShades(9) {
+		if shade != 0 {
+			t.Fatalf("line 9, x %d: got shade %d, want 0", x, shade)
+		}
+	}
+	for x, shade := range rowShades(11) {
+		if shade != 3 {
+			t.Fatalf("line 11, x %d: got shade %d, want 3", x, shade)
+		}
+	}
+
+	// Line 10 is split where the write landed
+	row := rowShades(10)
+	split := slices.Index(row, 3)
+	if split <= 0 || split >= SCREEN_WIDTH-1 {
+		t.Fatalf("line 10 should change shade mid-line, got %v", row)
+	}
+	for x := split; x < SCREEN_WIDTH; x++ {
+		if row[x] != 3 {
+			t.Errorf("line 10, x %d: got shade %d after the split at %d, want 3", x, row[x], split)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package gameboy
+
+import (
+	"image"
+	"image/color"
+)
+
+// Game Boy Printer, plugged into the serial port with SetSerialPeer.
+// The game sends packets with its internal clock:
+//   0x88 0x33, command, compression, length (LE), data, checksum (LE), then 2 bytes
+//   that the printer answers with 0x81 (alive) and its status.
+// Image data arrives as 2bpp tiles, 20 tiles per row, and is printed with the palette
+// given in the print command.
+
+const (
+	PRINTER_INIT   = 0x01
+	PRINTER_PRINT  = 0x02
+	PRINTER_DATA   = 0x04
+	PRINTER_STATUS = 0x0F
+)
+
+// Status bits
+const (
+	PRINTER_CHECKSUM_ERROR = 1 << 0
+	PRINTER_PRINTING       = 1 << 1
+	PRINTER_FULL           = 1 << 2 // image data ends, ready to print
+	PRINTER_UNPROCESSED    = 1 << 3 // image data waiting to be printed
+)
+
+const printerTilesPerRow = 20
+const printerMaxData = 0x280 * 9 // 9 bands of 2 tile rows
+
+// Paper shades, white to black
+var printerShades = []color.Gray{{0xFF}, {0xAA}, {0x55}, {0x00}}
+
+type Printer struct {
+	OnPrint func(image.Image) // called with each printout
+
+	pos         int // byte in the current packet
+	command     byte
+	compressed  bool
+	length      int
+	data        []byte
+	checksum    uint16 // calculated
+	gotChecksum uint16 // sent by the game
+
+	buf      []byte // decompressed image data
+	status   byte
+	printing int // status requests left before the printout is done
+}
+
+func NewPrinter(onPrint func(image.Image)) *Printer {
+	return &Printer{OnPrint: onPrint}
+}
+
+// SerialPeer, the game is always the one clocking.
+func (p *Printer) Exchange(out byte) (in byte) {
+	pos := p.pos
+	p.pos++
+
+	switch {
+	case pos == 0:
+		if out != 0x88 {
+			p.pos = 0
+		}
+		return 0x00
+	case pos == 1:
+		if out != 0x33 {
+			p.pos = 0
+		}
+		return 0x00
+	case pos == 2:
+		p.command = out
+		p.checksum = uint16(out)
+	case pos == 3:
+		p.compressed = out&1 != 0
+		p.checksum += uint16(out)
+	case pos == 4:
+		p.length = int(out)
+		p.checksum += uint16(out)
+	case pos == 5:
+		p.length |= int(out) << 8
+		p.checksum += uint16(out)
+		p.data = p.data[:0]
+	case pos < 6+p.length:
+		p.data = append(p.data, out)
+		p.checksum += uint16(out)
+	case pos == 6+p.length:
+		p.gotChecksum = uint16(out)
+	case pos == 7+p.length:
+		p.gotChecksum |= uint16(out) << 8
+		p.handlePacket()
+	case pos == 8+p.length:
+		return 0x81
+	default:
+		p.pos = 0
+		return p.status
+	}
+	return 0x00
+}
+
+func (p *Printer) handlePacket() {
+	if p.checksum != p.gotChecksum {
+		p.status |= PRINTER_CHECKSUM_ERROR
+		return
+	}
+	p.status &^= PRINTER_CHECKSUM_ERROR
+
+	switch p.command {
+	case PRINTER_INIT:
+		p.buf = p.buf[:0]
+		p.status = 0
+		p.printing = 0
+	case PRINTER_DATA:
+		if len(p.data) == 0 {
+			p.status |= PRINTER_FULL
+			return
+		}
+		data := p.data
+		if p.compressed {
+			data = decompressPrinterData(data)
+		}
+		p.buf = append(p.buf, data...)
+		if len(p.buf) > printerMaxData {
+			p.buf = p.buf[:printerMaxData]
+		}
+		p.status |= PRINTER_UNPROCESSED
+	case PRINTER_PRINT:
+		if len(p.data) < 4 {
+			return
+		}
+		if p.OnPrint != nil && len(p.buf) > 0 {
+			p.OnPrint(decodePrintout(p.buf, p.data[2]))
+		}
+		p.buf = p.buf[:0]
+		p.status = PRINTER_PRINTING
+		p.printing = 2
+	case PRINTER_STATUS:
+		if p.printing > 0 {
+			p.printing--
+			if p.printing == 0 {
+				p.status &^= PRINTER_PRINTING
+			}
+		}
+	}
+}
+
+// RLE: a control byte with bit 7 set repeats the next byte (n&0x7F)+2 times,
+// otherwise the next n+1 bytes are copied.
+func decompressPrinterData(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := data[i]
+		i++
+		if n&0x80 != 0 {
+			if i >= len(data) {
+				break
+			}
+			for j := 0; j < int(n&0x7F)+2; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		} else {
+			end := min(i+int(n)+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		}
+	}
+	return out
+}
+
+// 2bpp tiles, 20 per row, to a greyscale image.
+func decodePrintout(buf []byte, palette byte) *image.Gray {
+	if palette == 0 {
+		palette = 0xE4 // some games send 0 and mean the default
+	}
+	const tileBytes = 16
+	rows := len(buf) / (tileBytes * printerTilesPerRow)
+	img := image.NewGray(image.Rect(0, 0, printerTilesPerRow*8, rows*8))
+
+	for tile := 0; tile < rows*printerTilesPerRow; tile++ {
+		tx, ty := tile%printerTilesPerRow*8, tile/printerTilesPerRow*8
+		t := buf[tile*tileBytes:]
+		for y := 0; y < 8; y++ {
+			lo, hi := t[y*2], t[y*2+1]
+			for x := 0; x < 8; x++ {
+				bit := 7 - x
+				colourId := (hi>>bit&1)<<1 | lo>>bit&1
+				shade := (palette >> (colourId * 2)) & 0x3
+				img.SetGray(tx+x, ty+y, printerShades[shade])
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,123 @@
+package gameboy
+
+import (
+	"image"
+	"testing"
+)
+
+// Send a packet, returns the printer's last 2 replies (alive, status).
+func sendPrinterPacket(p *Printer, command byte, compressed bool, data []byte, badChecksum bool) (alive, status byte) {
+	var compression byte
+	if compressed {
+		compression = 1
+	}
+	header := []byte{command, compression, byte(len(data)), byte(len(data) >> 8)}
+	var sum uint16
+	for _, b := range append(header, data...) {
+		sum += uint16(b)
+	}
+	if badChecksum {
+		sum++
+	}
+
+	packet := append([]byte{0x88, 0x33}, header...)
+	packet = append(packet, data...)
+	packet = append(packet, byte(sum), byte(sum>>8), 0x00, 0x00)
+
+	var replies []byte
+	for _, b := range packet {
+		replies = append(replies, p.Exchange(b))
+	}
+	return replies[len(replies)-2], replies[len(replies)-1]
+}
+
+// One row of 20 tiles, tile n filled with colour n%4
+func printerTestRow() []byte {
+	var data []byte
+	for tile := 0; tile < 20; tile++ {
+		c := tile % 4
+		var lo, hi byte
+		if c&1 != 0 {
+			lo = 0xFF
+		}
+		if c&2 != 0 {
+			hi = 0xFF
+		}
+		for y := 0; y < 8; y++ {
+			data = append(data, lo, hi)
+		}
+	}
+	return data
+}
+
+func TestPrinterDecompress(t *testing.T) {
+	got := decompressPrinterData([]byte{0x82, 0xAB, 0x01, 0x11, 0x22, 0x80, 0x00})
+	want := []byte{0xAB, 0xAB, 0xAB, 0xAB, 0x11, 0x22, 0x00, 0x00}
+	if string(got) != string(want) {
+		t.Errorf("want % X, got % X", want, got)
+	}
+}
+
+func TestPrinterPrint(t *testing.T) {
+	var prints []image.Image
+	p := NewPrinter(func(img image.Image) { prints = append(prints, img) })
+
+	if alive, status := sendPrinterPacket(p, PRINTER_INIT, false, nil, false); alive != 0x81 || status != 0 {
+		t.Errorf("init: want 81/00, got %02X/%02X", alive, status)
+	}
+
+	row := printerTestRow()
+	if _, status := sendPrinterPacket(p, PRINTER_DATA, false, row, false); status != PRINTER_UNPROCESSED {
+		t.Errorf("data: want status 0x%02X, got 0x%02X", PRINTER_UNPROCESSED, status)
+	}
+	// The same row again, compressed: one literal run per 16 bytes is enough
+	var compressed []byte
+	for i := 0; i < len(row); i += 16 {
+		compressed = append(compressed, 15)
+		compressed = append(compressed, row[i:i+16]...)
+	}
+	sendPrinterPacket(p, PRINTER_DATA, true, compressed, false)
+	if _, status := sendPrinterPacket(p, PRINTER_DATA, false, nil, false); status&PRINTER_FULL == 0 {
+		t.Errorf("empty data packet should set the full bit, got 0x%02X", status)
+	}
+
+	// 1 sheet, no margins, palette 0x1B reverses the shades
+	if _, status := sendPrinterPacket(p, PRINTER_PRINT, false, []byte{0x01, 0x00, 0x1B, 0x40}, false); status&PRINTER_PRINTING == 0 {
+		t.Errorf("print should set the printing bit, got 0x%02X", status)
+	}
+
+	if len(prints) != 1 {
+		t.Fatalf("want 1 printout, got %d", len(prints))
+	}
+	img := prints[0].(*image.Gray)
+	if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 16 {
+		t.Fatalf("want 160x16, got %dx%d", b.Dx(), b.Dy())
+	}
+	// colour n is shade 3-n with the reversed palette
+	for tile, want := range []byte{0x00, 0x55, 0xAA, 0xFF} {
+		for _, y := range []int{0, 8} {
+			if got := img.GrayAt(tile*8+3, y+3).Y; got != want {
+				t.Errorf("tile %d, y %d: want 0x%02X, got 0x%02X", tile, y, want, got)
+			}
+		}
+	}
+
+	// Printing finishes after a status request or two
+	sendPrinterPacket(p, PRINTER_STATUS, false, nil, false)
+	if _, status := sendPrinterPacket(p, PRINTER_STATUS, false, nil, false); status&PRINTER_PRINTING != 0 {
+		t.Errorf("printing should be done, got 0x%02X", status)
+	}
+}
+
+func TestPrinterChecksumError(t *testing.T) {
+	p := NewPrinter(nil)
+	if _, status := sendPrinterPacket(p, PRINTER_DATA, false, printerTestRow(), true); status != PRINTER_CHECKSUM_ERROR {
+		t.Errorf("want checksum error, got 0x%02X", status)
+	}
+	if len(p.buf) != 0 {
+		t.Errorf("data with a bad checksum should be dropped")
+	}
+	if _, status := sendPrinterPacket(p, PRINTER_STATUS, false, nil, false); status != 0 {
+		t.Errorf("a good packet should clear the error, got 0x%02X", status)
+	}
+}
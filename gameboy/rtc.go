@@ -0,0 +1,182 @@
+package gameboy
+
+import (
+	"encoding/binary"
+	"time"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Source of the current time for cartridge clocks. Tests can replace it to control time.
+type TimeSource interface {
+	Now() time.Time
+}
+
+type systemTime struct{}
+
+func (systemTime) Now() time.Time {
+	return time.Now()
+}
+
+// RTC register indices, selected by writing 0x08-0x0C to 4000-5FFF on MBC3.
+const (
+	RTC_S  = iota // seconds 0-59
+	RTC_M         // minutes 0-59
+	RTC_H         // hours 0-23
+	RTC_DL        // lower 8 bits of day counter
+	RTC_DH        // bit 0 = day counter bit 8, bit 6 = halt, bit 7 = day counter carry
+)
+
+var rtcMasks = [5]byte{0x3F, 0x3F, 0x1F, 0xFF, 0xC1}
+
+// MBC3 real time clock.
+// The live registers keep counting while the game reads a latched copy of them.
+type RTC struct {
+	clock      TimeSource
+	regs       [5]byte
+	latched    [5]byte
+	lastUpdate time.Time // time the live registers were last brought up to date
+	latchPrev  byte      // previous write to 6000-7FFF, latch happens on 0x00 -> 0x01
+}
+
+func NewRTC(clock TimeSource) *RTC {
+	return &RTC{
+		clock:      clock,
+		lastUpdate: clock.Now(),
+		latchPrev:  0xFF,
+	}
+}
+
+func (r *RTC) halted() bool {
+	return utils.IsBitSet(6, r.regs[RTC_DH])
+}
+
+// Bring the live registers up to date with the time source.
+func (r *RTC) update() {
+	now := r.clock.Now()
+	if r.halted() {
+		r.lastUpdate = now
+		return
+	}
+
+	secs := int64(now.Sub(r.lastUpdate) / time.Second)
+	if secs <= 0 {
+		return
+	}
+	r.lastUpdate = r.lastUpdate.Add(time.Duration(secs) * time.Second)
+	r.advance(secs)
+}
+
+// Count forward a number of seconds.
+func (r *RTC) advance(secs int64) {
+	for secs > 0 {
+		// Skip whole days at once if the time registers hold valid values
+		if secs >= 86400 && r.regs[RTC_S] < 60 && r.regs[RTC_M] < 60 && r.regs[RTC_H] < 24 {
+			r.addDays(secs / 86400)
+			secs %= 86400
+			continue
+		}
+		r.tick()
+		secs--
+	}
+}
+
+// Count one second. Out of range values written by the game count up to the register's
+// bit width and wrap to 0 without carrying, like the real chip.
+func (r *RTC) tick() {
+	r.regs[RTC_S] = (r.regs[RTC_S] + 1) & rtcMasks[RTC_S]
+	if r.regs[RTC_S] != 60 {
+		return
+	}
+	r.regs[RTC_S] = 0
+
+	r.regs[RTC_M] = (r.regs[RTC_M] + 1) & rtcMasks[RTC_M]
+	if r.regs[RTC_M] != 60 {
+		return
+	}
+	r.regs[RTC_M] = 0
+
+	r.regs[RTC_H] = (r.regs[RTC_H] + 1) & rtcMasks[RTC_H]
+	if r.regs[RTC_H] != 24 {
+		return
+	}
+	r.regs[RTC_H] = 0
+
+	r.addDays(1)
+}
+
+// Add to the 9 bit day counter, setting the carry bit if it overflows.
+func (r *RTC) addDays(days int64) {
+	total := r.days() + days
+	if total > 0x1FF {
+		r.regs[RTC_DH] = utils.SetBit(7, r.regs[RTC_DH])
+		total %= 0x200
+	}
+	r.regs[RTC_DL] = byte(total)
+	r.regs[RTC_DH] = (r.regs[RTC_DH] & 0xFE) | byte(total>>8)&0x1
+}
+
+func (r *RTC) days() int64 {
+	return int64(r.regs[RTC_DL]) | int64(r.regs[RTC_DH]&0x1)<<8
+}
+
+// Copy the live registers to the latched registers on a 0x00 -> 0x01 write.
+func (r *RTC) WriteLatch(data byte) {
+	if r.latchPrev == 0x00 && data == 0x01 {
+		r.update()
+		r.latched = r.regs
+	}
+	r.latchPrev = data
+}
+
+// Games read the latched registers.
+func (r *RTC) Read(reg int) byte {
+	return r.latched[reg]
+}
+
+// Games write the live registers.
+func (r *RTC) Write(reg int, data byte) {
+	r.update()
+	if reg == RTC_S {
+		// Writing seconds resets the sub-second counter
+		r.lastUpdate = r.clock.Now()
+	}
+	r.regs[reg] = data & rtcMasks[reg]
+	r.latched[reg] = r.regs[reg]
+}
+
+// Save file footer in the format used by BGB and VBA-M, appended after cart RAM.
+// 5 live registers and 5 latched registers as little endian uint32s, followed by a 64 bit unix timestamp.
+// Some older emulators write a 32 bit timestamp instead (44 bytes), which is accepted on load.
+const RTC_FOOTER_SIZE = 48
+
+func (r *RTC) Footer() []byte {
+	r.update()
+	footer := make([]byte, RTC_FOOTER_SIZE)
+	for i := 0; i < 5; i++ {
+		binary.LittleEndian.PutUint32(footer[i*4:], uint32(r.regs[i]))
+		binary.LittleEndian.PutUint32(footer[20+i*4:], uint32(r.latched[i]))
+	}
+	binary.LittleEndian.PutUint64(footer[40:], uint64(r.lastUpdate.Unix()))
+	return footer
+}
+
+// Restore the registers from a save file footer. The clock catches up on the time passed since the save was written.
+func (r *RTC) LoadFooter(footer []byte) {
+	var timestamp int64
+	switch len(footer) {
+	case RTC_FOOTER_SIZE:
+		timestamp = int64(binary.LittleEndian.Uint64(footer[40:]))
+	case RTC_FOOTER_SIZE - 4:
+		timestamp = int64(binary.LittleEndian.Uint32(footer[40:]))
+	default:
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		r.regs[i] = byte(binary.LittleEndian.Uint32(footer[i*4:])) & rtcMasks[i]
+		r.latched[i] = byte(binary.LittleEndian.Uint32(footer[20+i*4:])) & rtcMasks[i]
+	}
+	r.lastUpdate = time.Unix(timestamp, 0)
+	r.update()
+}
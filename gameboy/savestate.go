@@ -0,0 +1,566 @@
+package gameboy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Save states
+// A save state file is "GOBOYSS", a little endian uint16 version, then the gob encoded machineState.
+// Bump SAVE_STATE_VERSION whenever a state struct changes, older states are refused.
+
+const SAVE_STATE_VERSION uint16 = 10
+
+var saveStateMagic = []byte("GOBOYSS")
+
+type machineState struct {
+	Title          string // for checking that the state belongs to the loaded rom
+	GlobalChecksum uint16
+	Bus            busState
+	CPU            cpuState
+	PPU            ppuState
+	LCD            lcdState
+	DMA            dmaState
+	Clock          clockState
+	Joypad         joypadState
+	APU            apuState
+	Serial         serialState
+	Cart           cartState
+}
+
+type busState struct {
+	WRAM    [0x2000]byte
+	HRAM    [0x7F]byte
+	Halted  bool
+	Stopped bool
+	BootROM []byte // nil once unmapped
+}
+
+type cpuState struct {
+	Registers     RegisterFile
+	ALUBusy       bool
+	ALUAdj        byte
+	IDUBusy       bool
+	InterruptAddr uint8
+	CurCycle      byte
+	Inst          Instruction
+	InstAddr      uint16
+	FlagMatched   bool
+	SetIME        bool
+	UntilIME      int
+	HaltBug       bool
+	SkipLog       bool
+}
+
+type pixelState struct {
+	C, Pal, BGPriority byte
+}
+
+type ppuState struct {
+	VRAM                                                   [0x2000]byte
+	LCDC, STAT, SCX, SCY, LY, LYC, BGP, OBP0, OBP1, WY, WX uint8
+	X                                                      byte
+	Mode                                                   string
+	Dot                                                    int
+	OAMScanI                                               byte
+	SavedObjects                                           []byte
+	FetchingObject                                         bool
+	ObjectToFetch                                          byte
+	ObjFetchStep                                           int
+	FetchStep                                              int
+	FetcherReset                                           bool
+	TileID, TileLow, TileHigh                              byte
+	TileTrim, ResumeTrim                                   byte
+	ObjTileID, ObjTileLow, ObjTileHigh                     byte
+	OldConditionState                                      byte
+	WindowLineCounter                                      byte
+	WindowReached                                          bool
+	WindowStartX                                           byte
+	BelowWindowTop                                         bool
+	FetchingWindow                                         bool
+	FirstLineAfterOn                                       bool
+	BgFIFO, ObjFIFO                                        []pixelState
+}
+
+type lcdState struct {
+	X, Y            byte
+	PixelsToDiscard byte
+	SkipFrame       bool
+}
+
+type dmaState struct {
+	OAM          [0xA0]byte
+	DMARequested bool
+	OAMDMA       bool
+	OAMSource    byte
+	NextSource   byte
+	OAMTransferI byte
+	OAMByte      byte
+}
+
+type clockState struct {
+	DIV              uint16
+	TIMA, TMA, TAC   byte
+	PrevAND          byte
+	SysClock         uint
+	TIMAState        int
+	TicksToTimerLoad int
+}
+
+// Sample rate and pending samples belong to the frontend and are not saved.
+type apuState struct {
+	Enabled       bool
+	Regs          [0x17]byte
+	Ch1, Ch2      SquareChannel
+	Ch3           WaveChannel
+	Ch4           NoiseChannel
+	FrameSeqStep  int
+	PrevDIVBit    bool
+	SampleCounter int
+	CapLeft       float64
+	CapRight      float64
+}
+
+type serialState struct {
+	SB, SC     byte
+	Bits       int
+	PrevDIVBit bool
+}
+
+type joypadState struct {
+	JOYP, Directions, Buttons, Lines byte
+}
+
+// Banking registers and RAM, shared by all mappers. Each mapper only uses the fields it needs.
+type cartState struct {
+	ROMBank     int
+	RAMBank     byte
+	BankingMode byte
+	RAMEnabled  bool
+	RAM         []byte
+	RTC         *rtcState
+	Motor       bool
+}
+
+type rtcState struct {
+	Regs, Latched [5]byte
+	LastUpdate    int64 // unix nanoseconds
+	LatchPrev     byte
+}
+
+// Write the state of the whole machine to w.
+func (b *Bus) SaveState(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.Write(saveStateMagic)
+	binary.Write(&buf, binary.LittleEndian, SAVE_STATE_VERSION)
+	if err := gob.NewEncoder(&buf).Encode(b.state()); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Restore the machine from a save state. The machine is left untouched if the state can't be read.
+func (b *Bus) LoadState(r io.Reader) error {
+	magic := make([]byte, len(saveStateMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, saveStateMagic) {
+		return fmt.Errorf("not a save state")
+	}
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return err
+	}
+	if version != SAVE_STATE_VERSION {
+		return fmt.Errorf("save state version %d is not supported, want version %d", version, SAVE_STATE_VERSION)
+	}
+
+	var s machineState
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	if h := b.cart.Header(); h != nil && (h.Title != s.Title || h.GlobalChecksum != s.GlobalChecksum) {
+		return fmt.Errorf("save state is for %q, not %q", s.Title, h.Title)
+	}
+
+	b.loadState(s)
+	return nil
+}
+
+// Slot files sit next to the rom, e.g. zelda.gb -> zelda.ss1
+func StatePath(romPath string, slot int) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + fmt.Sprintf(".ss%d", slot)
+}
+
+// Encodes the whole state, then writes it to a temporary file that replaces the slot,
+// so a failed save can't destroy the state already in the slot.
+func (m *Machine) SaveStateFile(path string) error {
+	var buf bytes.Buffer
+	if err := m.bus.SaveState(&buf); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m *Machine) LoadStateFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.bus.LoadState(f)
+}
+
+func (b *Bus) state() machineState {
+	s := machineState{
+		Bus: busState{
+			WRAM:    b.wram,
+			HRAM:    b.hram,
+			Halted:  b.halted,
+			Stopped: b.stopped,
+			BootROM: b.bootROM,
+		},
+		CPU:    b.cpu.state(),
+		PPU:    b.ppu.state(),
+		LCD:    lcdState{X: b.lcd.x, Y: b.lcd.y, PixelsToDiscard: b.lcd.pixelsToDiscard, SkipFrame: b.lcd.skipFrame},
+		DMA:    b.dma.state(),
+		Clock:  b.clock.state(),
+		Joypad: joypadState{JOYP: b.joypad.JOYP, Directions: b.joypad.Directions, Buttons: b.joypad.Buttons, Lines: b.joypad.lines},
+		APU:    b.apu.state(),
+		Serial: serialState{SB: b.serial.SB, SC: b.serial.SC, Bits: b.serial.bits, PrevDIVBit: b.serial.prevDIVBit},
+		Cart:   b.cart.state(),
+	}
+	if h := b.cart.Header(); h != nil {
+		s.Title = h.Title
+		s.GlobalChecksum = h.GlobalChecksum
+	}
+	return s
+}
+
+func (b *Bus) loadState(s machineState) {
+	b.wram = s.Bus.WRAM
+	b.hram = s.Bus.HRAM
+	b.halted = s.Bus.Halted
+	b.stopped = s.Bus.Stopped
+	b.bootROM = s.Bus.BootROM
+
+	b.cpu.loadState(s.CPU)
+	b.ppu.loadState(s.PPU)
+	b.lcd.x, b.lcd.y, b.lcd.pixelsToDiscard = s.LCD.X, s.LCD.Y, s.LCD.PixelsToDiscard
+	b.lcd.skipFrame = s.LCD.SkipFrame
+	b.dma.loadState(s.DMA)
+	b.clock.loadState(s.Clock)
+	b.joypad.JOYP, b.joypad.Directions, b.joypad.Buttons, b.joypad.lines = s.Joypad.JOYP, s.Joypad.Directions, s.Joypad.Buttons, s.Joypad.Lines
+	b.apu.loadState(s.APU)
+	b.serial.SB, b.serial.SC, b.serial.bits, b.serial.prevDIVBit = s.Serial.SB, s.Serial.SC, s.Serial.Bits, s.Serial.PrevDIVBit
+	b.cart.loadState(s.Cart)
+}
+
+func (c *CPU) state() cpuState {
+	return cpuState{
+		Registers:     c.RegisterFile,
+		ALUBusy:       c.ALUBusy,
+		ALUAdj:        c.GetAdj(),
+		IDUBusy:       c.IDUBusy,
+		InterruptAddr: c.interruptAddr,
+		CurCycle:      c.curCycle,
+		Inst:          c.inst,
+		InstAddr:      c.instAddr,
+		FlagMatched:   c.flagMatched,
+		SetIME:        c.setIME,
+		UntilIME:      c.untilIME,
+		HaltBug:       c.haltBug,
+		SkipLog:       c.skipLog,
+	}
+}
+
+func (c *CPU) loadState(s cpuState) {
+	c.RegisterFile = s.Registers
+	c.ALUBusy = s.ALUBusy
+	c.SetAdj(s.ALUAdj)
+	c.IDUBusy = s.IDUBusy
+	c.interruptAddr = s.InterruptAddr
+	c.curCycle = s.CurCycle
+	c.inst = s.Inst
+	c.instAddr = s.InstAddr
+	c.flagMatched = s.FlagMatched
+	c.setIME = s.SetIME
+	c.untilIME = s.UntilIME
+	c.haltBug = s.HaltBug
+	c.skipLog = s.SkipLog
+	c.restoreOpFunc()
+}
+
+func fifoState(f *FIFO) []pixelState {
+	pixels := []pixelState{}
+	for _, p := range *f {
+		pixels = append(pixels, pixelState{C: p.c, Pal: p.pal, BGPriority: p.bgPriority})
+	}
+	return pixels
+}
+
+func loadFIFOState(f *FIFO, pixels []pixelState) {
+	f.Clear()
+	for _, p := range pixels {
+		*f = append(*f, Pixel{c: p.C, pal: p.Pal, bgPriority: p.BGPriority})
+	}
+}
+
+func (p *PPU) state() ppuState {
+	return ppuState{
+		VRAM:              p.vram,
+		LCDC:              p.LCDC,
+		STAT:              p.STAT,
+		SCX:               p.SCX,
+		SCY:               p.SCY,
+		LY:                p.LY,
+		LYC:               p.LYC,
+		BGP:               p.BGP,
+		OBP0:              p.OBP0,
+		OBP1:              p.OBP1,
+		WY:                p.WY,
+		WX:                p.WX,
+		X:                 p.x,
+		Mode:              string(p.mode),
+		Dot:               p.dot,
+		OAMScanI:          p.oamScanI,
+		SavedObjects:      append([]byte{}, p.savedObjects...),
+		FetchingObject:    p.fetchingObject,
+		ObjectToFetch:     p.objectToFetch,
+		ObjFetchStep:      p.objFetchStep,
+		FetchStep:         p.fetchStep,
+		FetcherReset:      p.fetcherReset,
+		TileID:            p.tileID,
+		TileLow:           p.tileLow,
+		TileHigh:          p.tileHigh,
+		TileTrim:          p.tileTrim,
+		ResumeTrim:        p.resumeTrim,
+		ObjTileID:         p.objTileID,
+		ObjTileLow:        p.objTileLow,
+		ObjTileHigh:       p.objTileHigh,
+		OldConditionState: p.oldConditionState,
+		WindowLineCounter: p.windowLineCounter,
+		WindowReached:     p.windowReached,
+		WindowStartX:      p.windowStartX,
+		BelowWindowTop:    p.belowWindowTop,
+		FetchingWindow:    p.fetchingWindow,
+		FirstLineAfterOn:  p.firstLineAfterOn,
+		BgFIFO:            fifoState(p.bgFIFO),
+		ObjFIFO:           fifoState(p.objFIFO),
+	}
+}
+
+func (p *PPU) loadState(s ppuState) {
+	p.vram = s.VRAM
+	p.LCDC, p.STAT, p.SCX, p.SCY = s.LCDC, s.STAT, s.SCX, s.SCY
+	p.LY, p.LYC, p.BGP, p.OBP0, p.OBP1, p.WY, p.WX = s.LY, s.LYC, s.BGP, s.OBP0, s.OBP1, s.WY, s.WX
+	p.x = s.X
+	p.mode = ppuMode(s.Mode)
+	p.dot = s.Dot
+	p.oamScanI = s.OAMScanI
+	p.savedObjects = append([]byte{}, s.SavedObjects...)
+	p.fetchingObject = s.FetchingObject
+	p.objectToFetch = s.ObjectToFetch
+	p.objFetchStep = s.ObjFetchStep
+	p.fetchStep = s.FetchStep
+	p.fetcherReset = s.FetcherReset
+	p.tileID, p.tileLow, p.tileHigh = s.TileID, s.TileLow, s.TileHigh
+	p.tileTrim, p.resumeTrim = s.TileTrim, s.ResumeTrim
+	p.objTileID, p.objTileLow, p.objTileHigh = s.ObjTileID, s.ObjTileLow, s.ObjTileHigh
+	p.oldConditionState = s.OldConditionState
+	p.windowLineCounter = s.WindowLineCounter
+	p.windowReached = s.WindowReached
+	p.windowStartX = s.WindowStartX
+	p.belowWindowTop = s.BelowWindowTop
+	p.firstLineAfterOn = s.FirstLineAfterOn
+	p.fetchingWindow = s.FetchingWindow
+	// FIFOs are shared with the LCD, so load in place
+	loadFIFOState(p.bgFIFO, s.BgFIFO)
+	loadFIFOState(p.objFIFO, s.ObjFIFO)
+}
+
+func (a *APU) state() apuState {
+	return apuState{
+		Enabled:       a.enabled,
+		Regs:          a.regs,
+		Ch1:           a.ch1,
+		Ch2:           a.ch2,
+		Ch3:           a.ch3,
+		Ch4:           a.ch4,
+		FrameSeqStep:  a.frameSeqStep,
+		PrevDIVBit:    a.prevDIVBit,
+		SampleCounter: a.sampleCounter,
+		CapLeft:       a.capLeft,
+		CapRight:      a.capRight,
+	}
+}
+
+func (a *APU) loadState(s apuState) {
+	a.enabled = s.Enabled
+	a.regs = s.Regs
+	a.ch1, a.ch2, a.ch3, a.ch4 = s.Ch1, s.Ch2, s.Ch3, s.Ch4
+	a.frameSeqStep = s.FrameSeqStep
+	a.prevDIVBit = s.PrevDIVBit
+	a.sampleCounter = s.SampleCounter
+	a.capLeft, a.capRight = s.CapLeft, s.CapRight
+	a.samples = a.samples[:0]
+}
+
+func (d *DMA) state() dmaState {
+	return dmaState{
+		OAM:          d.oam,
+		DMARequested: d.dmaRequested,
+		OAMDMA:       d.oamDMA,
+		OAMSource:    d.oamSource,
+		NextSource:   d.nextSource,
+		OAMTransferI: d.oamTransferI,
+		OAMByte:      d.oamByte,
+	}
+}
+
+func (d *DMA) loadState(s dmaState) {
+	d.oam = s.OAM
+	d.dmaRequested = s.DMARequested
+	d.oamDMA = s.OAMDMA
+	d.oamSource = s.OAMSource
+	d.nextSource = s.NextSource
+	d.oamTransferI = s.OAMTransferI
+	d.oamByte = s.OAMByte
+}
+
+func (c *Clock) state() clockState {
+	return clockState{
+		DIV:              c.DIV,
+		TIMA:             c.TIMA,
+		TMA:              c.TMA,
+		TAC:              c.TAC,
+		PrevAND:          c.prevAND,
+		SysClock:         c.sysClock,
+		TIMAState:        int(c.TIMAState),
+		TicksToTimerLoad: c.ticksToTimerLoad,
+	}
+}
+
+func (c *Clock) loadState(s clockState) {
+	c.DIV = s.DIV
+	c.TIMA, c.TMA, c.TAC = s.TIMA, s.TMA, s.TAC
+	c.prevAND = s.PrevAND
+	c.sysClock = s.SysClock
+	c.TIMAState = timaState(s.TIMAState)
+	c.ticksToTimerLoad = s.TicksToTimerLoad
+}
+
+func (r *RTC) state() *rtcState {
+	return &rtcState{
+		Regs:       r.regs,
+		Latched:    r.latched,
+		LastUpdate: r.lastUpdate.UnixNano(),
+		LatchPrev:  r.latchPrev,
+	}
+}
+
+func (r *RTC) loadState(s *rtcState) {
+	r.regs = s.Regs
+	r.latched = s.Latched
+	r.lastUpdate = time.Unix(0, s.LastUpdate)
+	r.latchPrev = s.LatchPrev
+}
+
+func (c *ROMOnly) state() cartState {
+	return cartState{RAM: append([]byte{}, c.ram...)}
+}
+
+func (c *ROMOnly) loadState(s cartState) {
+	copy(c.ram, s.RAM)
+	c.ramWritten()
+}
+
+func (c *Cart) state() cartState {
+	return cartState{
+		ROMBank:     int(c.bank),
+		RAMBank:     c.secondaryBank,
+		BankingMode: c.bankingMode,
+		RAMEnabled:  c.ramEnabled,
+		RAM:         append([]byte{}, c.ram...),
+	}
+}
+
+func (c *Cart) loadState(s cartState) {
+	c.bank = byte(s.ROMBank)
+	c.secondaryBank = s.RAMBank
+	c.bankingMode = s.BankingMode
+	c.ramEnabled = s.RAMEnabled
+	copy(c.ram, s.RAM)
+	c.ramWritten()
+}
+
+func (c *MBC2) state() cartState {
+	return cartState{
+		ROMBank:    c.romBank,
+		RAMEnabled: c.ramEnabled,
+		RAM:        append([]byte{}, c.ram[:]...),
+	}
+}
+
+func (c *MBC2) loadState(s cartState) {
+	c.romBank = s.ROMBank
+	c.ramEnabled = s.RAMEnabled
+	copy(c.ram[:], s.RAM)
+	c.ramWritten()
+}
+
+func (c *MBC3) state() cartState {
+	s := cartState{
+		ROMBank:    c.romBank,
+		RAMBank:    c.ramBank,
+		RAMEnabled: c.ramEnabled,
+		RAM:        append([]byte{}, c.ram...),
+	}
+	if c.rtc != nil {
+		s.RTC = c.rtc.state()
+	}
+	return s
+}
+
+func (c *MBC3) loadState(s cartState) {
+	c.romBank = s.ROMBank
+	c.ramBank = s.RAMBank
+	c.ramEnabled = s.RAMEnabled
+	copy(c.ram, s.RAM)
+	if c.rtc != nil && s.RTC != nil {
+		c.rtc.loadState(s.RTC)
+	}
+	c.ramWritten()
+}
+
+func (c *MBC5) state() cartState {
+	return cartState{
+		ROMBank:    c.romBank,
+		RAMBank:    c.ramBank,
+		RAMEnabled: c.ramEnabled,
+		RAM:        append([]byte{}, c.ram...),
+		Motor:      c.motor,
+	}
+}
+
+func (c *MBC5) loadState(s cartState) {
+	c.romBank = s.ROMBank
+	c.ramBank = s.RAMBank
+	c.ramEnabled = s.RAMEnabled
+	copy(c.ram, s.RAM)
+	c.setMotor(s.Motor)
+	c.ramWritten()
+}
@@ -0,0 +1,121 @@
+package gameboy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Small program that keeps the CPU busy with a mix of plain, prefixed and memory ops.
+var saveStateTestProgram = []byte{
+	0x21, 0x00, 0xC0, // LD HL, 0xC000
+	0x3C,       // loop: INC A
+	0x22,       // LD (HL+), A
+	0xCB, 0x37, // SWAP A
+	0xF8, 0x02, // LD HL, SP+2 (2 cycle ALU adjust)
+	0x21, 0x00, 0xC0, // LD HL, 0xC000
+	0xC5,       // PUSH BC
+	0xC1,       // POP BC
+	0x18, 0xF3, // JR loop
+}
+
+func newSaveStateTestBus() *Bus {
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x100:], saveStateTestProgram)
+	cart, _ := NewCartridge(rom)
+	b := NewBus(cart)
+	return b
+}
+
+func saveStateBytes(t *testing.T, b *Bus) []byte {
+	var buf bytes.Buffer
+	if err := b.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSaveStateRestoresMidInstruction(t *testing.T) {
+	populatePrefixLookup()
+
+	for _, start := range []int{1001, 1002, 1003, 5005, 70225} {
+		original := newSaveStateTestBus()
+		for i := 0; i < start; i++ {
+			original.Cycle()
+		}
+		state := saveStateBytes(t, original)
+
+		restored := newSaveStateTestBus()
+		if err := restored.LoadState(bytes.NewReader(state)); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 20000; i++ {
+			original.Cycle()
+			restored.Cycle()
+		}
+
+		if !bytes.Equal(saveStateBytes(t, original), saveStateBytes(t, restored)) {
+			t.Errorf("state saved at cycle %d diverged after loading", start)
+		}
+	}
+}
+
+func TestLoadStateRejectsBadInput(t *testing.T) {
+	populatePrefixLookup()
+	b := newSaveStateTestBus()
+	for i := 0; i < 100; i++ {
+		b.Cycle()
+	}
+	state := saveStateBytes(t, b)
+
+	if err := b.LoadState(bytes.NewReader([]byte("not a state"))); err == nil {
+		t.Errorf("expected error for garbage input")
+	}
+
+	badVersion := append([]byte{}, state...)
+	badVersion[len(saveStateMagic)]++
+	if err := b.LoadState(bytes.NewReader(badVersion)); err == nil {
+		t.Errorf("expected error for unsupported version")
+	}
+
+	rom := newTestHeaderRom(0x00, 0x00, 0x00)
+	copy(rom[0x134:], "OTHERGAME")
+	cart, _ := NewCartridge(rom)
+	other := NewBus(cart)
+	if err := other.LoadState(bytes.NewReader(state)); err == nil {
+		t.Errorf("expected error when loading a state from another rom")
+	}
+}
+
+func TestSaveStateFileKeepsSlotOnFailure(t *testing.T) {
+	m := newTestMachine(t, saveStateTestProgram)
+	path := filepath.Join(t.TempDir(), "test.ss1")
+	if err := m.SaveStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary file can't be written
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	m.RunFrame()
+	if err := m.SaveStateFile(path); err == nil {
+		t.Fatal("want an error writing the save state")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("slot changed by a failed save")
+	}
+	if err := m.LoadStateFile(path); err != nil {
+		t.Errorf("slot no longer loads: %v", err)
+	}
+}
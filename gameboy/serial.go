@@ -0,0 +1,106 @@
+package gameboy
+
+import (
+	"io"
+
+	utils "github.com/mikzorz/goboy-emu/helpers"
+)
+
+// Serial port, FF01 SB and FF02 SC.
+// With the internal clock, a transfer shifts 8 bits at 8192 Hz then requests SERIAL_INTR.
+// With the external clock, the peer's transfer drives it.
+// Bytes are exchanged with the peer whole, when the 8th bit is shifted.
+
+// The other end of the link cable.
+type SerialPeer interface {
+	// Called when this side finishes a transfer with its internal clock.
+	// Returns the byte shifted back, 0xFF if nothing is listening.
+	Exchange(out byte) (in byte)
+}
+
+const SERIAL_CLOCK_SPEED = 8192 // Hz, internal clock
+
+type Serial struct {
+	bus         *Bus
+	SB, SC      byte
+	bits        int  // bits shifted in the current transfer
+	prevDIVBit  bool // for the 8192 Hz clock
+	peer        SerialPeer
+	log         io.Writer // bytes sent are written here, for blargg's test roms
+	transferred uint      // completed transfers, for tests
+}
+
+func NewSerial() *Serial {
+	return &Serial{}
+}
+
+func (s *Serial) transferring() bool {
+	return utils.IsBitSet(7, s.SC)
+}
+
+func (s *Serial) internalClock() bool {
+	return utils.IsBitSet(0, s.SC)
+}
+
+func (s *Serial) Read(addr uint16) byte {
+	if addr == 0xFF01 {
+		return s.SB
+	}
+	return s.SC | 0x7E
+}
+
+func (s *Serial) Write(addr uint16, data byte) {
+	if addr == 0xFF01 {
+		s.SB = data
+		return
+	}
+	s.SC = data
+	if s.transferring() {
+		s.bits = 0
+	}
+}
+
+// Called every T-cycle
+func (s *Serial) Cycle() {
+	// Internal clock is the falling edge of DIV bit 8, 4194304 / 512 = 8192 Hz
+	divBit := utils.IsBitSet(0, utils.MSB(s.bus.clock.DIV))
+	edge := s.prevDIVBit && !divBit
+	s.prevDIVBit = divBit
+
+	if !edge || !s.transferring() || !s.internalClock() {
+		return
+	}
+
+	s.bits++
+	if s.bits < 8 {
+		return
+	}
+
+	var in byte = 0xFF
+	if s.peer != nil {
+		in = s.peer.Exchange(s.SB)
+	}
+	s.complete(in)
+}
+
+// The peer has clocked a whole byte with its internal clock.
+// Returns the byte shifted out, 0xFF if no transfer was waiting on the external clock.
+func (s *Serial) receive(in byte) (out byte) {
+	if !s.transferring() || s.internalClock() {
+		return 0xFF
+	}
+	out = s.SB
+	s.complete(in)
+	return out
+}
+
+func (s *Serial) complete(in byte) {
+	if s.log != nil {
+		s.log.Write([]byte{s.SB})
+	}
+	s.SB = in
+	s.SC = utils.ResetBit(7, s.SC)
+	s.bits = 0
+	s.transferred++
+	s.bus.InterruptRequest(SERIAL_INTR)
+}
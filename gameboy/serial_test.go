@@ -0,0 +1,102 @@
+package gameboy
+
+import (
+	"bytes"
+	"testing"
+)
+
+type peerStub struct {
+	sent []byte
+	in   byte
+}
+
+func (p *peerStub) Exchange(out byte) byte {
+	p.sent = append(p.sent, out)
+	return p.in
+}
+
+func serialIF(m *Machine) bool {
+	return m.bus.cpu.IF&(1<<SERIAL_INTR) != 0
+}
+
+func TestSerialInternalClock(t *testing.T) {
+	log := &bytes.Buffer{}
+	m := newTestMachine(t, nil)
+	m.bus.serial.log = log
+	m.bus.cpu.IF = 0
+
+	m.bus.Write(0xFF01, 0x42)
+	m.bus.Write(0xFF02, 0x81)
+
+	// 8 bits at 8192 Hz, the first edge can come up to 512 cycles early
+	bitCycles := CLOCK_SPEED / SERIAL_CLOCK_SPEED
+	for i := 0; i < 7*bitCycles; i++ {
+		m.Tick()
+	}
+	if m.Read(0xFF02)&0x80 == 0 || serialIF(m) {
+		t.Fatalf("transfer finished early")
+	}
+	for i := 0; i < bitCycles; i++ {
+		m.Tick()
+	}
+
+	if got := m.Read(0xFF02); got != 0x7F {
+		t.Errorf("SC should read 0x7F after the transfer, got 0x%02X", got)
+	}
+	if got := m.Read(0xFF01); got != 0xFF {
+		t.Errorf("with nothing connected, want 0xFF shifted in, got 0x%02X", got)
+	}
+	if !serialIF(m) {
+		t.Errorf("transfer should request the serial interrupt")
+	}
+	if log.String() != "\x42" {
+		t.Errorf("want 0x42 logged, got %q", log.String())
+	}
+}
+
+func TestSerialPeer(t *testing.T) {
+	m := newTestMachine(t, nil)
+	peer := &peerStub{in: 0x99}
+	m.SetSerialPeer(peer)
+
+	m.bus.Write(0xFF01, 0x12)
+	m.bus.Write(0xFF02, 0x81)
+	for i := 0; i < 9*CLOCK_SPEED/SERIAL_CLOCK_SPEED; i++ {
+		m.Tick()
+	}
+
+	if len(peer.sent) != 1 || peer.sent[0] != 0x12 {
+		t.Errorf("want 0x12 sent once, got % X", peer.sent)
+	}
+	if got := m.Read(0xFF01); got != 0x99 {
+		t.Errorf("want 0x99 from the peer, got 0x%02X", got)
+	}
+}
+
+func TestSerialExternalClock(t *testing.T) {
+	m := newTestMachine(t, nil)
+	m.bus.cpu.IF = 0
+
+	if got := m.SerialReceive(0x55); got != 0xFF {
+		t.Errorf("no transfer waiting, want 0xFF, got 0x%02X", got)
+	}
+
+	m.bus.Write(0xFF01, 0x34)
+	m.bus.Write(0xFF02, 0x80)
+	for i := 0; i < CYCLES_PER_FRAME; i++ {
+		m.Tick()
+	}
+	if m.Read(0xFF02)&0x80 == 0 || serialIF(m) {
+		t.Fatalf("external clock transfer should wait for the peer")
+	}
+
+	if got := m.SerialReceive(0x55); got != 0x34 {
+		t.Errorf("want 0x34 shifted out, got 0x%02X", got)
+	}
+	if got := m.Read(0xFF01); got != 0x55 {
+		t.Errorf("want 0x55 shifted in, got 0x%02X", got)
+	}
+	if m.Read(0xFF02)&0x80 != 0 || !serialIF(m) {
+		t.Errorf("transfer should complete and request the serial interrupt")
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package gameboy
 
 import (
 	// "fmt"
+	"os"
 	"testing"
 )
 
@@ -12,7 +13,7 @@ import (
 // Fail: all = 0x42
 // To speed things up, LY and SC should always return 0xFF
 
-var path = "roms/mts-20240926-1737-443f6e1/acceptance"
+var path = "../roms/mts-20240926-1737-443f6e1/acceptance"
 
 // Start with 2 roms that currently pass and fail respectively.
 var roms = []string{
@@ -89,12 +90,15 @@ func TestRoms(t *testing.T) {
 	for _, rom := range roms {
 		t.Run(rom, func(t *testing.T) {
 
-			cart := NewCart()
+			data, err := os.ReadFile(path + rom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cart, err := NewCartridge(data)
+			if err != nil {
+				t.Fatal(err)
+			}
 			bus := NewBus(cart)
-			bus.screenDisabled = true
-
-			ReadRomFile(cart, path+rom)
-			populatePrefixLookup()
 
 			cpu := bus.cpu
 
@@ -1,4 +1,4 @@
-package main
+package gameboy
 
 import (
 	utils "github.com/mikzorz/goboy-emu/helpers"
@@ -13,54 +13,65 @@ type ObjFetcher struct {
 	Fetcher
 }
 
+// When the LCD reaches an object, it stops shifting out pixels until the object is fetched.
+// The fetch waits for the background fetcher to fetch its current tile's low byte with pixels in
+// the background FIFO, which costs up to 5 dots depending on where the object is in that tile,
+// then takes 6 dots.
 func (f *ObjFetcher) Cycle(p *PPU) {
-	// If there is a sprite at the current x position, reset background fetcher and pause it
-	// Pause the FIFO -> LCD pixel shifter
-	if i, ok := p.objectAtCurrentX(); ok && !p.fetchingObject {
-		// TODO: Potential minor optimisation
-		// Is it more optimal to check fetchingObject first, before calling objectAtCurrentX() ?
-		// Or does it not matter? Test, for curiosity's sake.
-		p.fetchStep = 0
-		p.fetchingObject = true
-		p.objectToFetch = i
+	if !p.fetchingObject {
+		f.findObject(p)
 	}
 
-	if p.fetchingObject {
+	if p.fetchingObject && p.objectFetchReady() {
 		f.Step(p)
 	}
 }
 
+// Start fetching the next object if it is at the LCD's x. Not until fine scroll pixels are discarded.
+func (f *ObjFetcher) findObject(p *PPU) bool {
+	if p.bus.lcd.pixelsToDiscard > 0 {
+		return false
+	}
+	for {
+		i, ok := p.objectAtCurrentX()
+		if !ok {
+			return false
+		}
+		// Disabled objects are skipped without being fetched
+		if utils.IsBitSet(1, p.LCDC) {
+			p.fetchingObject = true
+			p.objectToFetch = i
+			p.objFetchStep = 0
+			return true
+		}
+	}
+}
+
 func (f *ObjFetcher) Step(p *PPU) {
-	switch p.fetchStep {
+	switch p.objFetchStep {
 	case 1:
-		p.tileID = p.bus.dma.oam[p.objectToFetch+2]
+		p.objTileID = p.bus.dma.oam[p.objectToFetch+2]
 
 		// If LCDC.2 is set, sprites size = 8x16, else 8x8
 		if utils.IsBitSet(2, p.LCDC) {
-			y := (p.bus.dma.oam[p.objectToFetch])
-			row := p.objectRowOnScanline(y, p.LY, p.SCY)
-			if row < 8 {
+			if p.objectRow() < 8 {
 				// Top tile
-				p.tileID &= 0xFE
+				p.objTileID &= 0xFE
 			} else {
 				// Bottom tile
-				p.tileID |= 0x01
+				p.objTileID |= 0x01
 			}
 		}
 
 	case 3:
 		// get lo
-		// TODO: Y-flip
-		y := (p.bus.dma.oam[p.objectToFetch])
-		p.tileLow = p.fetchTileData(p.tileID, p.objectRowOnScanline(y, p.LY, p.SCY), false, true)
+		p.objTileLow = p.fetchTileData(p.objTileID, p.objectRow(), false, true)
 	case 5:
 		// get hi
-		// TODO: Y-flip
-		y := (p.bus.dma.oam[p.objectToFetch])
-		p.tileHigh = p.fetchTileData(p.tileID, p.objectRowOnScanline(y, p.LY, p.SCY), true, true)
-	case 7:
+		p.objTileHigh = p.fetchTileData(p.objTileID, p.objectRow(), true, true)
+	case 6:
 		// push to sprite fifo
-		pixelData := p.mergeTileBytes(p.tileHigh, p.tileLow)
+		pixelData := p.mergeTileBytes(p.objTileHigh, p.objTileLow)
 		objFlags := p.bus.dma.oam[p.objectToFetch+3]
 		if utils.IsBitSet(5, objFlags) {
 			// X-Flip
@@ -83,18 +94,22 @@ func (f *ObjFetcher) Step(p *PPU) {
 		p.objFIFO.PushObject(pixelData)
 
 		p.fetchingObject = false
-		p.fetchStep = 0
+		// Another object at the same x is fetched straight away, this dot is the first of its 6
+		if f.findObject(p) {
+			p.objFetchStep = 1
+		}
 		return
 	}
-	p.fetchStep++
+	p.objFetchStep++
 }
 
 type BGFetcher struct {
 	Fetcher
 }
 
+// Keeps going while an object is waiting for it, and stops while the object is fetched.
 func (f *BGFetcher) Cycle(p *PPU) {
-	if !p.fetchingObject {
+	if !p.fetchingObject || !p.objectFetchReady() {
 		f.Step(p)
 	}
 }
@@ -103,6 +118,7 @@ func (f *BGFetcher) Step(p *PPU) {
 	switch p.fetchStep {
 	case 1:
 		// Fetch tile id from map
+		p.tileTrim, p.resumeTrim = p.resumeTrim, 0
 		if p.fetchingWindow {
 			p.tileID = p.getWindowIDFromMap(p.x, p.windowLineCounter)
 		} else {
@@ -129,10 +145,11 @@ func (f *BGFetcher) Step(p *PPU) {
 			p.fetcherReset = true
 			return
 		}
-	case 7:
+	case 6:
+		// Push when the FIFO is empty, the LCD pops the first pixel on the same dot
 		if p.bgFIFO.CanPushBG() {
 			pixelData := p.mergeTileBytes(p.tileHigh, p.tileLow)
-			p.bgFIFO.Push(pixelData)
+			p.bgFIFO.Push(pixelData[p.tileTrim:])
 			p.x += 8
 			p.fetchStep = 0
 		}
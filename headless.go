@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/mikzorz/goboy-emu/gameboy"
+)
+
+// Running a rom without a window, for CI and test roms.
+
+type headlessConfig struct {
+	frames      int    // frames to run, or the time limit if there is a stop condition
+	untilPC     int    // stop when the instruction at this address is fetched, -1 to disable
+	untilSerial string // stop when this appears in the serial output
+	failSerial  string // stop and fail when this appears in the serial output
+	untilLDBB   bool   // stop at LD B,B, passes if B/C/D/E/H/L are 3/5/8/13/21/34 (mooneye)
+
+	screenshotPath string
+	serialPath     string
+	summaryPath    string // "-" for stdout
+}
+
+// Stop conditions are checked after every instruction, otherwise whole frames are run.
+func (c headlessConfig) stepping() bool {
+	return c.untilPC >= 0 || c.untilSerial != "" || c.failSerial != "" || c.untilLDBB
+}
+
+type headlessRegisters struct {
+	A, F, B, C, D, E, H, L byte
+	SP, PC                 uint16
+}
+
+type headlessSummary struct {
+	ROM       string            `json:"rom"`
+	Passed    bool              `json:"passed"`
+	Reason    string            `json:"reason"` // why the run stopped
+	Frames    int               `json:"frames"`
+	Cycles    int               `json:"cycles"`
+	Registers headlessRegisters `json:"registers"`
+	Serial    string            `json:"serial"`
+}
+
+// Run until a stop condition is met or cfg.frames have passed.
+// serial must be the machine's SerialLog.
+func (e *emulator) runHeadless(cfg headlessConfig, serial *bytes.Buffer) headlessSummary {
+	s := headlessSummary{ROM: e.romPath, Reason: "frames", Passed: !cfg.stepping()}
+
+	serialLen := 0
+run:
+	for s.Frames < cfg.frames {
+		if !cfg.stepping() {
+			e.gb.RunFrame()
+		} else {
+			end := e.gb.Cycles() + gameboy.CYCLES_PER_FRAME
+			for e.gb.Cycles() < end {
+				e.gb.StepInstruction()
+				if reason, passed, done := checkStop(cfg, e.gb, serial, &serialLen); done {
+					s.Reason, s.Passed = reason, passed
+					e.flushAudio()
+					break run
+				}
+			}
+		}
+		s.Frames++
+		e.flushAudio()
+	}
+	if s.Frames >= cfg.frames && cfg.stepping() {
+		s.Reason = "timeout"
+	}
+
+	r := e.gb.Registers()
+	s.Registers = headlessRegisters{
+		A: r.A, F: r.F,
+		B: byte(r.BC >> 8), C: byte(r.BC),
+		D: byte(r.DE >> 8), E: byte(r.DE),
+		H: byte(r.HL >> 8), L: byte(r.HL),
+		SP: r.SP, PC: r.PC,
+	}
+	s.Cycles = e.gb.Cycles()
+	s.Serial = serial.String()
+	return s
+}
+
+func checkStop(cfg headlessConfig, gb *gameboy.Machine, serial *bytes.Buffer, serialLen *int) (reason string, passed, done bool) {
+	addr, op := gb.Opcode()
+	if cfg.untilPC >= 0 && int(addr) == cfg.untilPC {
+		return "pc", true, true
+	}
+	if cfg.untilLDBB && op == 0x40 {
+		r := gb.Registers()
+		switch {
+		case r.BC == 0x0305 && r.DE == 0x080D && r.HL == 0x1522:
+			return "ld b,b", true, true
+		case r.BC == 0x4242 && r.DE == 0x4242 && r.HL == 0x4242:
+			return "ld b,b", false, true
+		default:
+			// e.g. crashed into a 0x40 byte
+			return "ld b,b (unexpected registers)", false, true
+		}
+	}
+	if serial.Len() != *serialLen {
+		*serialLen = serial.Len()
+		out := serial.Bytes()
+		if cfg.failSerial != "" && bytes.Contains(out, []byte(cfg.failSerial)) {
+			return "serial", false, true
+		}
+		if cfg.untilSerial != "" && bytes.Contains(out, []byte(cfg.untilSerial)) {
+			return "serial", true, true
+		}
+	}
+	return "", false, false
+}
+
+// Write the requested output files.
+func (e *emulator) writeHeadlessOutput(cfg headlessConfig, s headlessSummary) error {
+	if cfg.screenshotPath != "" {
+		if err := writeScreenshot(cfg.screenshotPath, e.gb); err != nil {
+			return err
+		}
+	}
+	if cfg.serialPath != "" {
+		if err := os.WriteFile(cfg.serialPath, []byte(s.Serial), 0644); err != nil {
+			return err
+		}
+	}
+
+	if cfg.summaryPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if cfg.summaryPath == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(cfg.summaryPath, data, 0644)
+}
+
+// Save the last complete frame as a PNG, in the window's palette.
+func writeScreenshot(path string, gb *gameboy.Machine) error {
+	w := gb.Width()
+	fb := gb.Framebuffer()
+	img := image.NewRGBA(image.Rect(0, 0, w, len(fb)/w))
+	for i, shade := range fb {
+		img.Set(i%w, i/w, palette[shade])
+	}
+	return writePNG(path, img)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("could not encode %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikzorz/goboy-emu/gameboy"
+)
+
+func newHeadlessEmulator(t *testing.T, program []byte) (*emulator, *bytes.Buffer) {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], program)
+	serial := &bytes.Buffer{}
+	gb, err := gameboy.New(rom, gameboy.Options{SerialLog: serial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &emulator{gb: gb, romPath: "test.gb"}, serial
+}
+
+// Sends "OK" over serial, then LD B,B forever
+var headlessProgram = []byte{
+	0x3E, 'O', // LD A, 'O'
+	0xE0, 0x01, // LDH (SB), A
+	0x3E, 0x81, // LD A, 0x81
+	0xE0, 0x02, // LDH (SC), A
+	0xF0, 0x02, // LDH A, (SC)
+	0x07,       // RLCA
+	0x38, 0xFB, // JR C, -5 ; until the transfer is done
+	0x3E, 'K', // LD A, 'K'
+	0xE0, 0x01, // LDH (SB), A
+	0x3E, 0x81, // LD A, 0x81
+	0xE0, 0x02, // LDH (SC), A
+	0xF0, 0x02, // LDH A, (SC)
+	0x07,       // RLCA
+	0x38, 0xFB, // JR C, -5
+	0x40,       // LD B, B
+	0x18, 0xFD, // JR -3
+}
+
+func TestHeadlessStopConditions(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cfg        headlessConfig
+		wantReason string
+		wantPassed bool
+		wantPC     uint16 // after fetching the instruction at the stop address, 0 to skip
+	}{
+		{"frames", headlessConfig{frames: 2, untilPC: -1}, "frames", true, 0},
+		{"pc", headlessConfig{frames: 2, untilPC: 0x104}, "pc", true, 0x105},
+		{"serial", headlessConfig{frames: 2, untilPC: -1, untilSerial: "OK"}, "serial", true, 0},
+		{"fail serial", headlessConfig{frames: 2, untilPC: -1, failSerial: "O"}, "serial", false, 0},
+		{"ld b,b unexpected", headlessConfig{frames: 2, untilPC: -1, untilLDBB: true}, "ld b,b (unexpected registers)", false, 0x11B},
+		{"timeout", headlessConfig{frames: 2, untilPC: 0x4000}, "timeout", false, 0},
+	}
+
+	for _, tt := range testCases {
+		e, serial := newHeadlessEmulator(t, headlessProgram)
+		s := e.runHeadless(tt.cfg, serial)
+		if s.Reason != tt.wantReason || s.Passed != tt.wantPassed {
+			t.Errorf("%s: want %s/%v, got %s/%v", tt.name, tt.wantReason, tt.wantPassed, s.Reason, s.Passed)
+		}
+		if tt.wantPC != 0 && s.Registers.PC != tt.wantPC {
+			t.Errorf("%s: want PC 0x%04X, got 0x%04X", tt.name, tt.wantPC, s.Registers.PC)
+		}
+	}
+}
+
+func TestHeadlessFramesAndSerial(t *testing.T) {
+	e, serial := newHeadlessEmulator(t, headlessProgram)
+	s := e.runHeadless(headlessConfig{frames: 3, untilPC: -1}, serial)
+	if s.Frames != 3 {
+		t.Errorf("want 3 frames, got %d", s.Frames)
+	}
+	if s.Serial != "OK" {
+		t.Errorf("want serial output %q, got %q", "OK", s.Serial)
+	}
+}
+
+func TestHeadlessMooneyeResult(t *testing.T) {
+	testCases := []struct {
+		name       string
+		b, c, d, e byte
+		h, l       byte
+		wantReason string
+		wantPassed bool
+	}{
+		{"fibonacci", 3, 5, 8, 13, 21, 34, "ld b,b", true},
+		{"0x42", 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, "ld b,b", false},
+		{"neither", 3, 5, 8, 13, 21, 0, "ld b,b (unexpected registers)", false},
+	}
+
+	for _, tt := range testCases {
+		e, serial := newHeadlessEmulator(t, []byte{
+			0x06, tt.b, // LD B, n
+			0x0E, tt.c, // LD C, n
+			0x16, tt.d, // LD D, n
+			0x1E, tt.e, // LD E, n
+			0x26, tt.h, // LD H, n
+			0x2E, tt.l, // LD L, n
+			0x40,       // LD B, B
+			0x18, 0xFD, // JR -3
+		})
+		s := e.runHeadless(headlessConfig{frames: 2, untilPC: -1, untilLDBB: true}, serial)
+		if s.Reason != tt.wantReason || s.Passed != tt.wantPassed {
+			t.Errorf("%s: want %s/%v, got %s/%v", tt.name, tt.wantReason, tt.wantPassed, s.Reason, s.Passed)
+		}
+	}
+}
+
+func TestSaveBatteryWritesClockOnExit(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	rom[0x100], rom[0x101] = 0x18, 0xFE // JR -2
+	rom[0x147] = 0x0F                   // MBC3+TIMER+BATTERY, no RAM for the game to write
+	gb, err := gameboy.New(rom, gameboy.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &emulator{gb: gb, romPath: "test.gb", savePath: filepath.Join(t.TempDir(), "test.sav")}
+	gb.RunFrame()
+
+	e.saveBattery(false)
+	if _, err := os.Stat(e.savePath); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("want no save file before exit, got %v", err)
+	}
+
+	e.saveBattery(true)
+	data, err := os.ReadFile(e.savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 48 {
+		t.Errorf("want the 48 byte clock footer, got %d bytes", len(data))
+	}
+}
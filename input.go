@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mikzorz/goboy-emu/gameboy"
+)
+
+// Keyboard and gamepad bindings for the joypad and emulator hotkeys.
+// Every action can have any number of bindings, set with "bindings" in the config file.
+
+type inputKind int
+
+const (
+	inputKey inputKind = iota
+	inputPadButton
+	inputPadStick
+)
+
+const gamepad = 0 // only the first gamepad is used
+
+type binding struct {
+	kind  inputKind
+	code  int32   // raylib key, gamepad button or gamepad axis
+	dir   float32 // sticks: 1 or -1, the direction that counts as down
+	shift bool    // keys: shift must be held, for hotkeys without it shift must not be held
+}
+
+// Deflection an analog stick needs before it counts as a d-pad press, 0-1.
+var stickDeadzone float32 = 0.5
+
+var joypadActions = map[string]gameboy.Button{
+	"a":      gameboy.JoyA,
+	"b":      gameboy.JoyB,
+	"select": gameboy.JoySelect,
+	"start":  gameboy.JoyStart,
+	"right":  gameboy.JoyRight,
+	"left":   gameboy.JoyLeft,
+	"up":     gameboy.JoyUp,
+	"down":   gameboy.JoyDown,
+}
+
+var hotkeyActions = []string{
+	"pause", "fast_forward", "screenshot",
+	"save_state_1", "save_state_2", "save_state_3", "save_state_4",
+	"load_state_1", "load_state_2", "load_state_3", "load_state_4",
+}
+
+var defaultBindings = map[string][]string{
+	"a":      {"z", "pad_east"},
+	"b":      {"x", "pad_south"},
+	"select": {"backspace", "pad_select"},
+	"start":  {"enter", "pad_start"},
+	// Not the arrow keys, the debugger uses them with -dev
+	"right": {"l", "pad_right", "stick_right"},
+	"left":  {"j", "pad_left", "stick_left"},
+	"up":    {"i", "pad_up", "stick_up"},
+	"down":  {"k", "pad_down", "stick_down"},
+
+	"pause":        {"p"},
+	"fast_forward": {"tab", "pad_rt"},
+	"screenshot":   {"f12"},
+	"save_state_1": {"shift+f1"},
+	"save_state_2": {"shift+f2"},
+	"save_state_3": {"shift+f3"},
+	"save_state_4": {"shift+f4"},
+	"load_state_1": {"f1"},
+	"load_state_2": {"f2"},
+	"load_state_3": {"f3"},
+	"load_state_4": {"f4"},
+}
+
+// Parsed from defaultBindings and the config file by setBindings.
+var bindings = map[string][]binding{}
+
+func init() {
+	if err := setBindings(defaultBindings); err != nil {
+		panic(err)
+	}
+}
+
+var keyNames = map[string]int32{
+	"space":     rl.KeySpace,
+	"escape":    rl.KeyEscape,
+	"enter":     rl.KeyEnter,
+	"tab":       rl.KeyTab,
+	"backspace": rl.KeyBackspace,
+	"right":     rl.KeyRight,
+	"left":      rl.KeyLeft,
+	"down":      rl.KeyDown,
+	"up":        rl.KeyUp,
+	"lshift":    rl.KeyLeftShift,
+	"rshift":    rl.KeyRightShift,
+	"lctrl":     rl.KeyLeftControl,
+	"rctrl":     rl.KeyRightControl,
+	"lalt":      rl.KeyLeftAlt,
+	"ralt":      rl.KeyRightAlt,
+	",":         rl.KeyComma,
+	".":         rl.KeyPeriod,
+	"/":         rl.KeySlash,
+	";":         rl.KeySemicolon,
+	"-":         rl.KeyMinus,
+	"=":         rl.KeyEqual,
+}
+
+// Named by position, so that Xbox/Nintendo/PlayStation layouts don't disagree.
+var padButtonNames = map[string]int32{
+	"pad_up":     rl.GamepadButtonLeftFaceUp,
+	"pad_right":  rl.GamepadButtonLeftFaceRight,
+	"pad_down":   rl.GamepadButtonLeftFaceDown,
+	"pad_left":   rl.GamepadButtonLeftFaceLeft,
+	"pad_north":  rl.GamepadButtonRightFaceUp,
+	"pad_east":   rl.GamepadButtonRightFaceRight,
+	"pad_south":  rl.GamepadButtonRightFaceDown,
+	"pad_west":   rl.GamepadButtonRightFaceLeft,
+	"pad_lb":     rl.GamepadButtonLeftTrigger1,
+	"pad_lt":     rl.GamepadButtonLeftTrigger2,
+	"pad_rb":     rl.GamepadButtonRightTrigger1,
+	"pad_rt":     rl.GamepadButtonRightTrigger2,
+	"pad_select": rl.GamepadButtonMiddleLeft,
+	"pad_home":   rl.GamepadButtonMiddle,
+	"pad_start":  rl.GamepadButtonMiddleRight,
+}
+
+// Left stick only
+var stickNames = map[string]binding{
+	"stick_right": {kind: inputPadStick, code: rl.GamepadAxisLeftX, dir: 1},
+	"stick_left":  {kind: inputPadStick, code: rl.GamepadAxisLeftX, dir: -1},
+	"stick_down":  {kind: inputPadStick, code: rl.GamepadAxisLeftY, dir: 1},
+	"stick_up":    {kind: inputPadStick, code: rl.GamepadAxisLeftY, dir: -1},
+}
+
+// e.g. "z", "f1", "shift+f1", "pad_south", "stick_left"
+func parseBinding(s string) (binding, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+
+	if b, ok := stickNames[name]; ok {
+		return b, nil
+	}
+	if code, ok := padButtonNames[name]; ok {
+		return binding{kind: inputPadButton, code: code}, nil
+	}
+
+	b := binding{kind: inputKey}
+	if rest, ok := strings.CutPrefix(name, "shift+"); ok {
+		b.shift = true
+		name = rest
+	}
+	fn, fnErr := strconv.Atoi(strings.TrimPrefix(name, "f"))
+	switch {
+	case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+		b.code = rl.KeyA + int32(name[0]-'a')
+	case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+		b.code = rl.KeyZero + int32(name[0]-'0')
+	case strings.HasPrefix(name, "f") && fnErr == nil && fn >= 1 && fn <= 12:
+		b.code = rl.KeyF1 + int32(fn-1)
+	default:
+		code, ok := keyNames[name]
+		if !ok {
+			return binding{}, fmt.Errorf("unknown key or button %q", s)
+		}
+		b.code = code
+	}
+	return b, nil
+}
+
+// Replace the bindings of the actions in m, other actions keep theirs.
+func setBindings(m map[string][]string) error {
+	parsed := map[string][]binding{}
+	for action, names := range m {
+		if !isAction(action) {
+			return fmt.Errorf("unknown action %q, want one of %s", action, strings.Join(actionNames(), ", "))
+		}
+		for _, name := range names {
+			b, err := parseBinding(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", action, err)
+			}
+			if b.kind == inputKey && slices.Contains(debuggerKeys, b.code) {
+				log.Printf("%s: %q is also a debugger key, with -dev it does both", action, name)
+			}
+			parsed[action] = append(parsed[action], b)
+		}
+		if len(names) == 0 {
+			parsed[action] = nil // unbound
+		}
+	}
+
+	for action, bs := range parsed {
+		bindings[action] = bs
+	}
+	return nil
+}
+
+func isAction(action string) bool {
+	if _, ok := joypadActions[action]; ok {
+		return true
+	}
+	for _, a := range hotkeyActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func actionNames() []string {
+	names := append([]string{}, hotkeyActions...)
+	for a := range joypadActions {
+		names = append(names, a)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func shiftDown() bool {
+	return rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+}
+
+// exactShift is for hotkeys, so that "f1" and "shift+f1" can do different things.
+func (b binding) down(exactShift bool) bool {
+	switch b.kind {
+	case inputPadButton:
+		return rl.IsGamepadAvailable(gamepad) && rl.IsGamepadButtonDown(gamepad, b.code)
+	case inputPadStick:
+		return rl.IsGamepadAvailable(gamepad) && rl.GetGamepadAxisMovement(gamepad, b.code)*b.dir > stickDeadzone
+	}
+	if !rl.IsKeyDown(b.code) {
+		return false
+	}
+	if b.shift || exactShift {
+		return b.shift == shiftDown()
+	}
+	return true
+}
+
+// Tracks hotkeys between frames, so that holding one only triggers it once.
+type hotkeys struct {
+	held map[string]bool
+}
+
+func newHotkeys() *hotkeys {
+	return &hotkeys{held: map[string]bool{}}
+}
+
+func (h *hotkeys) down(action string) bool {
+	for _, b := range bindings[action] {
+		if b.down(true) {
+			return true
+		}
+	}
+	return false
+}
+
+// Call once per frame for each action. True on the frame the action is first held.
+func (h *hotkeys) pressed(action string) bool {
+	down := h.down(action)
+	was := h.held[action]
+	h.held[action] = down
+	return down && !was
+}
+
+func (e *emulator) getJoypadInput() {
+	for action, button := range joypadActions {
+		pressed := false
+		for _, b := range bindings[action] {
+			if b.down(false) {
+				pressed = true
+				break
+			}
+		}
+		e.gb.SetButton(button, pressed)
+	}
+}
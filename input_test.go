@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestParseBinding(t *testing.T) {
+	testCases := []struct {
+		name string
+		want binding
+	}{
+		{"z", binding{kind: inputKey, code: rl.KeyZ}},
+		{"Z", binding{kind: inputKey, code: rl.KeyZ}},
+		{"7", binding{kind: inputKey, code: rl.KeySeven}},
+		{"f", binding{kind: inputKey, code: rl.KeyF}},
+		{"f10", binding{kind: inputKey, code: rl.KeyF10}},
+		{"shift+f2", binding{kind: inputKey, code: rl.KeyF2, shift: true}},
+		{"enter", binding{kind: inputKey, code: rl.KeyEnter}},
+		{"pad_south", binding{kind: inputPadButton, code: rl.GamepadButtonRightFaceDown}},
+		{"stick_up", binding{kind: inputPadStick, code: rl.GamepadAxisLeftY, dir: -1}},
+	}
+	for _, tt := range testCases {
+		got, err := parseBinding(tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s: want %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{"", "f13", "f0", "shift+", "pad_x", "ctrl+a"} {
+		if _, err := parseBinding(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestSetBindings(t *testing.T) {
+	t.Cleanup(func() {
+		if err := setBindings(defaultBindings); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := setBindings(map[string][]string{"a": {"space", "pad_north"}, "pause": {}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bindings["a"]) != 2 || bindings["a"][0].code != rl.KeySpace {
+		t.Errorf("a should be rebound to space and pad_north, got %+v", bindings["a"])
+	}
+	if len(bindings["pause"]) != 0 {
+		t.Errorf("an empty list should unbind, got %+v", bindings["pause"])
+	}
+	if len(bindings["b"]) != len(defaultBindings["b"]) {
+		t.Errorf("actions not in the map should keep their bindings")
+	}
+
+	before := bindings["start"]
+	if err := setBindings(map[string][]string{"start": {"space"}, "jump": {"z"}}); err == nil {
+		t.Errorf("unknown actions should be an error")
+	}
+	if bindings["start"][0] != before[0] {
+		t.Errorf("bindings should not change on error")
+	}
+}
+
+// With -dev, a key press must not both move the game and drive the debugger
+func TestDefaultBindingsAvoidDebuggerKeys(t *testing.T) {
+	for action, names := range defaultBindings {
+		for _, name := range names {
+			b, err := parseBinding(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.kind == inputKey && slices.Contains(debuggerKeys, b.code) {
+				t.Errorf("%s: default binding %q is a debugger key", action, name)
+			}
+		}
+	}
+}
@@ -1,59 +1,61 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mikzorz/goboy-emu/gameboy"
 )
 
-// const DEV = true
+// Settings, see config.go
 
-const DEV = false
+var DEV = false
 
-const GAMEBOY_DOCTOR = false
-
-var logfile *os.File
+var GAMEBOY_DOCTOR = false
 
 var enableDebugInfo bool
 
-var joypadMap = map[int32]Button{
-	rl.KeyZ:         JoyA,
-	rl.KeyX:         JoyB,
-	rl.KeyBackspace: JoySelect,
-	rl.KeyEnter:     JoyStart,
-	rl.KeyL:         JoyRight,
-	rl.KeyJ:         JoyLeft,
-	rl.KeyI:         JoyUp,
-	rl.KeyK:         JoyDown,
-}
+const saveInterval = 300 // frames between saves if a game leaves RAM enabled
+
+// Link cable addresses, "tcp:host:port", "unix:path" or "host:port"
+var linkListen, linkConnect string
+
+// Directory for Game Boy Printer output, empty for no printer
+var printerDir string
 
-var romPath string
-var romData []byte
+// DMG boot rom to run first, empty to skip straight to the cart
+var bootROMPath string
+
+const fastForwardFrames = 4 // frames run per displayed frame while fast-forwarding
 
 type Screen struct {
 	w, h int32
 	x, y int32
 }
 
-// const TRUEWIDTH int32 = 256 // Some test messages are too long to fit on the normal screen.
-const TRUEWIDTH int32 = 160
-const TRUEHEIGHT int32 = 144
+var TRUEWIDTH int32 = gameboy.SCREEN_WIDTH // Some test messages are too long to fit on the normal screen, try 256.
+const TRUEHEIGHT int32 = gameboy.SCREEN_HEIGHT
 
 var gameWinScale int32 = 3
 
-var gameWindow = Screen{
-	w: TRUEWIDTH * gameWinScale,
-	h: TRUEHEIGHT * gameWinScale,
-	x: 0,
-	y: 0,
-}
+var palette = palettes["green"]
+
+// Set by layoutWindows
+var gameWindow Screen
 
-// var gameImg *rl.Image
-var gameScreen rl.RenderTexture2D
+var gameScreen rl.Texture2D
+var gamePixels []color.RGBA // framebuffer converted through the palette, uploaded to gameScreen
 
 // Debug Info Attributes
 var bytesPerRow = 16
@@ -62,161 +64,379 @@ var instructions map[uint16]string
 var tilePixels []byte
 
 // main window
-// game screen size + some space.
-var window = Screen{
-	w: gameWindow.w + 10 + 960,
-	h: gameWindow.h + 10 + 320,
-	x: 0,
-	y: 0,
+// game screen size + some space for debug info.
+var window Screen
+
+// Size the windows for the current settings.
+func layoutWindows() {
+	gameWindow = Screen{
+		w: TRUEWIDTH * gameWinScale,
+		h: TRUEHEIGHT * gameWinScale,
+	}
+	if DEV {
+		window = Screen{
+			w: gameWindow.w + 10 + 960,
+			h: gameWindow.h + 10 + 320,
+		}
+	} else {
+		window = Screen{w: gameWindow.w, h: gameWindow.h}
+	}
+	debugX = max(memRowWidth, gameWindow.w) + 5
 }
 
-// var cpu = NewCPU()
-var ppu = NewPPU()
-var cart = NewCart()
-var bus = NewBus(cart)
+// The frontend, everything that isn't the emulated machine.
+type emulator struct {
+	gb              *gameboy.Machine
+	romPath         string
+	savePath        string // battery save
+	framesSinceSave int
+	audio           *AudioOutput // nil if there is no audio device
+	recorder        *WAVWriter   // nil unless recording audio
+	debugger        *debugger
+	hotkeys         *hotkeys
+	printouts       int
+	paused          bool
+	fastForward     bool
+}
 
-func ReadRomFile(c *Cart, romPath string) {
+func ReadRomFile(romPath string) []byte {
 	data, err := os.ReadFile(romPath)
 	if err != nil {
 		log.Panic(err)
 	}
+	return data
+}
+
+func newEmulator(romPath, recordAudioPath string, doctorLog, serialLog io.Writer) *emulator {
+	opts := gameboy.Options{
+		ScreenWidth: int(TRUEWIDTH),
+		DoctorLog:   doctorLog,
+		SerialLog:   serialLog,
+	}
+	if bootROMPath != "" {
+		opts.BootROM = ReadRomFile(bootROMPath)
+	}
+	if GAMEBOY_DOCTOR {
+		opts.AlwaysVBlank = true
+	}
+
+	// picks a mapper based on the cart header
+	gb, err := gameboy.New(ReadRomFile(romPath), opts)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	e := &emulator{
+		gb:       gb,
+		romPath:  romPath,
+		savePath: gameboy.SavePath(romPath),
+		debugger: newDebugger(),
+		hotkeys:  newHotkeys(),
+	}
+
+	if r, ok := gb.Cartridge().(gameboy.RumbleCart); ok {
+		r.SetRumbleHandler(rumble)
+	}
+	if err := gameboy.LoadBatterySave(gb.Cartridge(), e.savePath); err != nil {
+		log.Printf("could not load save file: %v", err)
+	}
+	if DEV {
+		fmt.Println(gb.Header())
+	}
+
+	if recordAudioPath != "" {
+		e.recorder, err = CreateWAV(recordAudioPath, audioSampleRate)
+		if err != nil {
+			log.Fatalf("could not record audio: %v", err)
+		}
+		gb.SetSampleRate(audioSampleRate)
+	}
+
+	if printerDir != "" {
+		if linkListen != "" || linkConnect != "" {
+			log.Fatal("the printer and the link cable both need the serial port, pick one")
+		}
+		gb.SetSerialPeer(gameboy.NewPrinter(e.savePrintout))
+	}
+
+	if linkListen != "" || linkConnect != "" {
+		addr, listen := linkConnect, false
+		if linkListen != "" {
+			addr, listen = linkListen, true
+			log.Printf("waiting for link cable connection on %s", addr)
+		}
+		conn, err := gameboy.DialLink(addr, listen)
+		if err != nil {
+			log.Fatalf("could not connect link cable: %v", err)
+		}
+		gameboy.Connect(gb, conn)
+	}
 
-	// copy cart bytes from file to byte slice
-	c.LoadROMData(data)
+	return e
 }
 
-func _init() {
+func main() {
+	var romPath, recordAudioPath, untilPC, configPath string
+	var headless bool
+	hc := headlessConfig{untilPC: -1}
 	flag.StringVar(&romPath, "rom", "", "The path to the rom file.")
+	flag.StringVar(&recordAudioPath, "record-audio", "", "Record the sound output to a WAV file.")
+	flag.StringVar(&linkListen, "link-listen", "", "Wait for another goboy to connect a link cable, e.g. tcp::5000 or unix:/tmp/goboy.sock.")
+	flag.StringVar(&linkConnect, "link-connect", "", "Connect a link cable to a goboy started with -link-listen, e.g. tcp:localhost:5000.")
+	flag.StringVar(&printerDir, "printer", "", "Plug in a Game Boy Printer, printouts are saved as PNGs in this directory.")
+	flag.StringVar(&bootROMPath, "bootrom", "", "Run this 256 byte DMG boot rom before the cart.")
+	flag.BoolVar(&headless, "headless", false, "Run without a window. Exits with status 1 if the run fails.")
+	flag.IntVar(&hc.frames, "frames", 600, "Headless: frames to run, or the time limit if a stop condition is given.")
+	flag.StringVar(&untilPC, "until-pc", "", "Headless: stop when the instruction at this hex address is reached.")
+	flag.StringVar(&hc.untilSerial, "until-serial", "", "Headless: stop when the serial output contains this string.")
+	flag.StringVar(&hc.failSerial, "fail-serial", "", "Headless: stop and fail when the serial output contains this string.")
+	flag.BoolVar(&hc.untilLDBB, "until-ldbb", false, "Headless: stop at LD B,B, passing only if B/C/D/E/H/L are 3/5/8/13/21/34 (mooneye).")
+	flag.StringVar(&hc.screenshotPath, "screenshot", "", "Headless: save the final frame as a PNG.")
+	flag.StringVar(&hc.serialPath, "serial-out", "", "Headless: save the serial output as text.")
+	flag.StringVar(&hc.summaryPath, "summary", "-", "Headless: write a JSON summary here, - for stdout.")
+	defineSettingsFlags(flag.CommandLine, &configPath)
 	flag.Parse()
 
-	// Load ROM
 	if romPath == "" {
 		fmt.Println("no rom provided")
 		os.Exit(1)
-	} else {
-		// fmt.Println(romPath)
-		ReadRomFile(cart, romPath)
+	}
 
-		populatePrefixLookup()
-		if DEV {
-			// instructions = disassemble(disAssembleStart, disAssembleEnd)
-			enableDebugInfo = true
-		} else {
-			gameWindow.x, gameWindow.y = 0, 0
-			window.w, window.h = gameWindow.w, gameWindow.h
-			enableDebugInfo = false
+	// The config files need the rom path, then the command line is parsed again so that it wins.
+	if err := loadConfig(configPath, romPath); err != nil {
+		fmt.Printf("could not load config: %v\n", err)
+		os.Exit(2)
+	}
+	flag.Parse()
+	layoutWindows()
+	if untilPC != "" {
+		pc, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(untilPC), "0x"), 16, 16)
+		if err != nil {
+			fmt.Printf("bad -until-pc: %v\n", err)
+			os.Exit(2)
 		}
+		hc.untilPC = int(pc)
+	}
 
+	if headless || GAMEBOY_DOCTOR {
+		os.Exit(runHeadless(romPath, recordAudioPath, hc))
 	}
-}
 
-func main() {
+	var serialLog io.Writer
+	if DEV {
+		serialLog = os.Stdout
+	}
+	e := newEmulator(romPath, recordAudioPath, nil, serialLog)
+	defer e.stopRecording()
 
-	_init()
-	if GAMEBOY_DOCTOR {
-		var err error
-		logfile, err = os.Create("gbdoctor_logfile.log")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer logfile.Close()
-		bus.screenDisabled = true
-		bus.alwaysVblank = true
-		for i := 0; i < 400000; i++ { // Not an endless loop, filled RAM accidentally.
-			for cycle := 0; cycle < 4; cycle++ {
-				bus.Cycle()
-			}
-		}
-		os.Exit(0)
+	if DEV {
+		// instructions = disassemble(disAssembleStart, disAssembleEnd)
+		enableDebugInfo = true
+	} else {
+		enableDebugInfo = false
 	}
 
 	rl.InitWindow(window.w, window.h, "Game Boy Emulator made in Go")
 	defer rl.CloseWindow()
 
+	rl.InitAudioDevice()
+	defer rl.CloseAudioDevice()
+	if rl.IsAudioDeviceReady() {
+		e.audio = NewAudioOutput(e.gb)
+		defer e.audio.Close()
+	} else {
+		log.Println("no audio device, running without sound")
+	}
+
 	if DEV {
 		debugFont = rl.LoadFont(debugFontPath)
 		defer rl.UnloadFont(debugFont)
 	}
 
-	gameScreen = rl.LoadRenderTexture(TRUEWIDTH, TRUEHEIGHT)
-	defer rl.UnloadRenderTexture(gameScreen)
+	img := rl.GenImageColor(int(TRUEWIDTH), int(TRUEHEIGHT), palette[0])
+	gameScreen = rl.LoadTextureFromImage(img)
+	rl.UnloadImage(img)
+	defer rl.UnloadTexture(gameScreen)
+	gamePixels = make([]color.RGBA, TRUEWIDTH*TRUEHEIGHT)
 
+	// Upper limit, audio sync does the actual pacing when there is sound
 	rl.SetTargetFPS(60)
 
-	defer func() {
-		// if r := recover(); r != nil {
-		// 	log.Printf("Crashed at address 0x%04X\n", bus.cpu.PC)
-		// 	log.Printf("OP: 0x%02X %s, opcycle: %d\n", bus.cpu.IR, bus.cpu.inst.Op, bus.cpu.curCycle)
-		// }
-	}()
+	defer e.saveBattery(true)
 
 	for !rl.WindowShouldClose() {
-		rl.BeginTextureMode(gameScreen)
-
-		getJoypadInput()
+		e.getJoypadInput()
+		e.handleHotkeys()
 
 		if DEV {
-			handleDebugInput()
+			e.debugger.handleInput(e.gb)
+			e.debugger.run(e.gb)
+		} else if !e.paused {
+			frames := 1
+			if e.fastForward {
+				frames = fastForwardFrames
+			}
+			for i := 0; i < frames; i++ {
+				e.gb.RunFrame()
+			}
+		}
 
-			if !paused {
-				for i := 0; i < cyclesPerFrame; i++ {
-					paused = checkBreakpoints()
+		e.drawGameScreen()
+		e.flushAudio()
+		e.draw()
 
-					if !paused {
-						tick()
-					}
-				}
-			}
+		e.saveBattery(false)
+	}
+}
 
-			if enableDebugInfo {
-				disAssembleStart = bus.cpu.PC - instructionsPeekAmount - 10 // 10 margin
-				// disAssembleStart = bus.cpu.PC //
-				disAssembleEnd = bus.cpu.PC + instructionsPeekAmount + 10
-				// instructions = disassemble(disAssembleStart, disAssembleEnd)
-			}
-		} else {
-			for i := 0; i < 70224; i++ {
-				tick()
-			}
+// Returns the exit status.
+func runHeadless(romPath, recordAudioPath string, cfg headlessConfig) int {
+	var doctorLog io.Writer
+	if GAMEBOY_DOCTOR {
+		logfile, err := os.Create("gbdoctor_logfile.log")
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer logfile.Close()
+		doctorLog = logfile
+	}
+
+	serial := &bytes.Buffer{}
+	e := newEmulator(romPath, recordAudioPath, doctorLog, serial)
+	s := e.runHeadless(cfg, serial)
+	e.stopRecording()
+	e.saveBattery(true)
+
+	if err := e.writeHeadlessOutput(cfg, s); err != nil {
+		log.Printf("could not write output: %v", err)
+		return 1
+	}
+	if !s.Passed {
+		return 1
+	}
+	return 0
+}
 
-		rl.EndTextureMode()
-		draw()
+// Hand the samples produced since the last call to the recorder and the audio device.
+func (e *emulator) flushAudio() {
+	samples := e.gb.AudioSamples()
+	if e.recorder != nil {
+		if err := e.recorder.Write(samples); err != nil {
+			log.Printf("could not record audio: %v", err)
+		}
+	}
+	// Fast-forward is paced by the frame rate cap, so the extra sound is only recorded
+	if e.audio != nil && !e.fastForward {
+		e.audio.Sync(samples)
 	}
 }
 
-func tick() {
-	bus.Cycle()
-	curCycle++
+func (e *emulator) stopRecording() {
+	if e.recorder == nil {
+		return
+	}
+	if err := e.recorder.Close(); err != nil {
+		log.Printf("could not finish audio recording: %v", err)
+	}
+	e.recorder = nil
 }
 
-func mcycle() {
-	for i := 0; i < 4; i++ {
-		tick()
+func (e *emulator) savePrintout(img image.Image) {
+	e.printouts++
+	name := fmt.Sprintf("%s-print-%s-%d.png", strings.TrimSuffix(filepath.Base(e.romPath), filepath.Ext(e.romPath)), time.Now().Format("20060102-150405"), e.printouts)
+	if err := writePNG(filepath.Join(printerDir, name), img); err != nil {
+		log.Printf("could not save printout: %v", err)
 	}
 }
 
-func getJoypadInput() {
+func (e *emulator) handleHotkeys() {
+	h := e.hotkeys
+	if h.pressed("pause") {
+		e.paused = !e.paused
+	}
+	e.fastForward = h.down("fast_forward")
+
+	if h.pressed("screenshot") {
+		path := fmt.Sprintf("%s-%s.png", strings.TrimSuffix(e.romPath, filepath.Ext(e.romPath)), time.Now().Format("20060102-150405"))
+		if err := writeScreenshot(path, e.gb); err != nil {
+			log.Printf("could not save screenshot: %v", err)
+		}
+	}
 
-	for k, input := range joypadMap {
-		if rl.IsKeyDown(k) {
-			bus.joypad.Press(input)
-		} else {
-			bus.joypad.Release(input)
+	for slot := 1; slot <= 4; slot++ {
+		save := h.pressed(fmt.Sprintf("save_state_%d", slot))
+		load := h.pressed(fmt.Sprintf("load_state_%d", slot))
+		path := gameboy.StatePath(e.romPath, slot)
+		if save {
+			if err := e.gb.SaveStateFile(path); err != nil {
+				log.Printf("could not save state: %v", err)
+			}
+		} else if load {
+			if err := e.gb.LoadStateFile(path); err != nil {
+				log.Printf("could not load state: %v", err)
+			}
 		}
 	}
+}
+
+// Write the battery save when the game disables cart RAM after writing to it,
+// every saveInterval frames if the game leaves RAM enabled, and on exit.
+// Carts with a clock are always written on exit, the clock keeps running without the game writing to RAM.
+func (e *emulator) saveBattery(exiting bool) {
+	b, ok := e.gb.Battery()
+	if !ok {
+		return
+	}
+	if exiting && e.gb.Header().HasTimer() {
+		e.writeBattery()
+		return
+	}
+	if !b.Unsaved() {
+		return
+	}
+
+	e.framesSinceSave++
+	if exiting || b.FlushRequested() || e.framesSinceSave >= saveInterval {
+		e.writeBattery()
+	}
+}
+
+func (e *emulator) writeBattery() {
+	if err := gameboy.WriteBatterySave(e.gb.Cartridge(), e.savePath); err != nil {
+		log.Printf("could not write save file: %v", err)
+	}
+	e.framesSinceSave = 0
+}
 
+// Forward the cart's rumble motor to the first gamepad.
+func rumble(on bool) {
+	if !rl.IsGamepadAvailable(0) {
+		return
+	}
+	if on {
+		rl.SetGamepadVibration(0, 1, 1, 0.5)
+	} else {
+		rl.SetGamepadVibration(0, 0, 0, 0)
+	}
+}
+
+// Upload the machine's last complete frame to the game screen texture.
+func (e *emulator) drawGameScreen() {
+	for i, shade := range e.gb.Framebuffer() {
+		gamePixels[i] = palette[shade]
+	}
+	rl.UpdateTexture(gameScreen, gamePixels)
 }
 
-// draw the window with debug info and update the PPU. PPU handles the game only.
-func draw() {
+// draw the window with debug info and the game screen.
+func (e *emulator) draw() {
 	rl.BeginDrawing()
 	rl.ClearBackground(color.RGBA{20, 20, 20, 255})
 	if DEV && enableDebugInfo {
-		drawDebugInfo()
+		e.debugger.draw(e.gb)
 	}
-	if shouldDrawGame {
-		rl.DrawTextureEx(gameScreen.Texture, rl.Vector2{float32(gameWindow.x), float32(gameWindow.y)}, 0, float32(gameWinScale), rl.White)
+	if e.debugger.shouldDrawGame {
+		rl.DrawTextureEx(gameScreen, rl.Vector2{float32(gameWindow.x), float32(gameWindow.y)}, 0, float32(gameWinScale), rl.White)
 	}
 	rl.EndDrawing()
 }
@@ -0,0 +1,39 @@
+package main
+
+import "math"
+
+// Linear interpolating resampler for interleaved stereo samples.
+// The ratio can be nudged while running, to keep the audio buffer from draining or overfilling.
+type Resampler struct {
+	inRate  float64
+	outRate float64
+	step    float64 // input frames per output frame
+	pos     float64 // position between prev and the next input frame, 0-1
+	prev    [2]float32
+}
+
+func NewResampler(inRate, outRate int) *Resampler {
+	r := &Resampler{inRate: float64(inRate), outRate: float64(outRate)}
+	r.SetAdjust(0)
+	return r
+}
+
+// Stretch the output by a fraction, e.g. 0.005 produces 0.5% more output frames.
+func (r *Resampler) SetAdjust(adjust float64) {
+	r.step = r.inRate / (r.outRate * (1 + adjust))
+}
+
+// Resample interleaved int16 frames, appending float32 frames to out.
+func (r *Resampler) Process(in []int16, out []float32) []float32 {
+	for i := 0; i+1 < len(in); i += 2 {
+		cur := [2]float32{float32(in[i]) / math.MaxInt16, float32(in[i+1]) / math.MaxInt16}
+		for r.pos < 1 {
+			t := float32(r.pos)
+			out = append(out, r.prev[0]+(cur[0]-r.prev[0])*t, r.prev[1]+(cur[1]-r.prev[1])*t)
+			r.pos += r.step
+		}
+		r.pos--
+		r.prev = cur
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResamplerFrameCount(t *testing.T) {
+	testCases := []struct {
+		inRate, outRate int
+		adjust          float64
+		want            int
+	}{
+		{48000, 48000, 0, 4800},
+		{48000, 24000, 0, 2400},
+		{24000, 48000, 0, 9600},
+		{48000, 48000, 0.005, 4824},
+		{48000, 48000, -0.005, 4776},
+	}
+
+	in := make([]int16, 4800*2)
+	for _, tt := range testCases {
+		r := NewResampler(tt.inRate, tt.outRate)
+		r.SetAdjust(tt.adjust)
+		out := r.Process(in, nil)
+		if got := len(out) / 2; math.Abs(float64(got-tt.want)) > 1 {
+			t.Errorf("%d -> %d Hz, adjust %v: want ~%d frames, got %d", tt.inRate, tt.outRate, tt.adjust, tt.want, got)
+		}
+	}
+}
+
+func TestResamplerInterpolates(t *testing.T) {
+	r := NewResampler(24000, 48000)
+	out := r.Process([]int16{math.MaxInt16, 0, math.MaxInt16, 0}, nil)
+
+	// Output starts from silence, halfway frame is interpolated
+	want := []float32{0, 0, 0.5, 0, 1, 0, 1, 0}
+	if len(out) != len(want) {
+		t.Fatalf("want %d samples, got %d", len(want), len(out))
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Errorf("sample %d: want %v, got %v", i, want[i], out[i])
+		}
+	}
+}
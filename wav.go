@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// Writes 16 bit stereo PCM samples to a WAV file.
+// The header sizes are filled in when the writer is closed.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	dataBytes  uint32
+}
+
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w, sampleRate: sampleRate}
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+// Create a WAV file at path.
+func CreateWAV(path string, sampleRate int) (*WAVWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := NewWAVWriter(f, sampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (wav *WAVWriter) writeHeader() error {
+	const channels = 2
+	const bitsPerSample = 16
+	blockAlign := channels * bitsPerSample / 8
+
+	header := []any{
+		[]byte("RIFF"),
+		uint32(36 + wav.dataBytes),
+		[]byte("WAVE"),
+		[]byte("fmt "),
+		uint32(16), // fmt chunk size
+		uint16(1),  // PCM
+		uint16(channels),
+		uint32(wav.sampleRate),
+		uint32(wav.sampleRate * blockAlign), // byte rate
+		uint16(blockAlign),
+		uint16(bitsPerSample),
+		[]byte("data"),
+		wav.dataBytes,
+	}
+	for _, v := range header {
+		if err := binary.Write(wav.w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Append interleaved left, right samples.
+func (wav *WAVWriter) Write(samples []int16) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if err := binary.Write(wav.w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	wav.dataBytes += uint32(len(samples) * 2)
+	return nil
+}
+
+// Fill in the header sizes and close the underlying file, if it is one.
+func (wav *WAVWriter) Close() error {
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := wav.writeHeader(); err != nil {
+		return err
+	}
+	if c, ok := wav.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
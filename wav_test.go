@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWAVWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	wav, err := CreateWAV(path, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav.Write([]int16{1, -1, 2, -2})
+	wav.Write([]int16{0x7FFF, -0x8000})
+	if err := wav.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if len(data) != wavHeaderSize+12 {
+		t.Fatalf("want %d bytes, got %d", wavHeaderSize+12, len(data))
+	}
+
+	le := binary.LittleEndian
+	testCases := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"RIFF size", le.Uint32(data[4:]), 36 + 12},
+		{"channels", uint32(le.Uint16(data[22:])), 2},
+		{"sample rate", le.Uint32(data[24:]), 48000},
+		{"byte rate", le.Uint32(data[28:]), 48000 * 4},
+		{"bits per sample", uint32(le.Uint16(data[34:])), 16},
+		{"data size", le.Uint32(data[40:]), 12},
+	}
+	for _, tt := range testCases {
+		if tt.got != tt.want {
+			t.Errorf("%s: want %d, got %d", tt.name, tt.want, tt.got)
+		}
+	}
+
+	if !bytes.Equal(data[:4], []byte("RIFF")) || !bytes.Equal(data[8:16], []byte("WAVEfmt ")) || !bytes.Equal(data[36:40], []byte("data")) {
+		t.Errorf("bad chunk ids in header % X", data[:44])
+	}
+	if got := int16(le.Uint16(data[wavHeaderSize+10:])); got != -0x8000 {
+		t.Errorf("last sample: want -32768, got %d", got)
+	}
+}